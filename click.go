@@ -0,0 +1,132 @@
+package main
+
+import (
+	"log"
+	"math"
+	"time"
+)
+
+// maxClickRewind is the farthest clickFreeze moves the pointer back, in
+// pixels. Longer moves were meant, not a wobble.
+const maxClickRewind = 40
+
+// pointerSample is where the pointer was sent at a time, in desktop pixels
+// for the absolute mode and in emitted pixels for the relative ones.
+type pointerSample struct {
+	t    time.Time
+	x, y float64
+}
+
+// record remembers an emitted pointer position for clickFreeze, dropping
+// samples older than it.
+func (h *handler) record(c PointerConfig, now time.Time, x, y float64) {
+	window := c.clickFreeze()
+	if window == 0 {
+		h.history = h.history[:0]
+		return
+	}
+	i := 0
+	for i < len(h.history) && now.Sub(h.history[i].t) > window {
+		i++
+	}
+	// Keep the last sample before the window, it is where the pointer was
+	// when the window started.
+	if i > 0 {
+		i--
+	}
+	h.history = append(h.history[i:], pointerSample{now, x, y})
+}
+
+// frozen reports whether pointer motion is held still around a click.
+func (h *handler) frozen(now time.Time) bool {
+	return now.Before(h.freezeUntil)
+}
+
+// freeze moves the pointer back to where it was clickFreeze ago and holds
+// it there for clickFreeze, so the wobble of pressing the wheel doesn't
+// move the click.
+func (h *handler) freeze(c PointerConfig, now time.Time) {
+	window := c.clickFreeze()
+	if window == 0 {
+		return
+	}
+	h.freezeUntil = now.Add(window)
+	var back *pointerSample
+	for i := range h.history {
+		if now.Sub(h.history[i].t) < window {
+			break
+		}
+		back = &h.history[i]
+	}
+	if back == nil && len(h.history) > 0 {
+		back = &h.history[0]
+	}
+	if back == nil {
+		return
+	}
+	cur := h.history[len(h.history)-1]
+	if math.Hypot(cur.x-back.x, cur.y-back.y) > maxClickRewind {
+		return
+	}
+	if c.mode() == pointerAbsolute {
+		h.sink.Move(int(back.x), int(back.y))
+	} else {
+		dx, dy := back.x-h.emittedX, back.y-h.emittedY
+		if dx != 0 || dy != 0 {
+			h.sink.MoveRelative(int(dx), int(dy))
+		}
+		h.virtX, h.virtY = back.x, back.y
+		h.emittedX, h.emittedY = back.x, back.y
+		h.filters.reset(c.Filters)
+	}
+	h.history = append(h.history[:0], pointerSample{now, back.x, back.y})
+}
+
+// button handles the remote's wheel button, the left mouse button. With
+// drag lock on, a tap grabs, keeping the left button down, and the next tap
+// lets go. Holding the wheel button longer is a normal press and drag.
+func (h *handler) button(down bool) {
+	if down && h.isLocked() {
+		return
+	}
+	c := h.pointerConfig()
+	now := time.Now()
+	// freeze only uses the pointer state, which belongs to this goroutine
+	// and not to h.mu, see handler.
+	h.freeze(c, now)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	hold := c.dragLock()
+	switch {
+	case down && h.dragLocked:
+		// A tap releases the drag, its own release is swallowed.
+		h.setDragLock(false)
+		h.swallowUp = true
+	case down:
+		h.pressedAt = now
+		h.sink.Click("left", true)
+	case h.swallowUp:
+		h.swallowUp = false
+	case hold > 0 && now.Sub(h.pressedAt) < hold:
+		// A tap grabs, the left button stays down.
+		h.dragLocked = true
+		log.Printf("pointer: drag locked")
+	default:
+		h.sink.Click("left", false)
+	}
+}
+
+// setDragLock holds or releases the left button, with h.mu held.
+func (h *handler) setDragLock(on bool) {
+	if on == h.dragLocked {
+		return
+	}
+	h.dragLocked = on
+	h.sink.Click("left", on)
+	if on {
+		log.Printf("pointer: drag locked")
+	} else {
+		log.Printf("pointer: drag released")
+	}
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// Combo is an action run when several remote keys are pressed together.
+// The keys' own actions are suppressed when it fires.
+type Combo struct {
+	// Keys by keycode or name, see keyNames.
+	Keys []string `json:"keys"`
+	Action
+
+	codes []int
+}
+
+func (c *Combo) resolve() error {
+	if len(c.Keys) < 2 {
+		return fmt.Errorf("combo needs at least two keys")
+	}
+	seen := make(map[int]bool, len(c.Keys))
+	c.codes = c.codes[:0]
+	for _, k := range c.Keys {
+		code, err := parseKeyCode(k)
+		if err != nil {
+			return err
+		}
+		if seen[code] {
+			return fmt.Errorf("combo %v has key %s twice", c.Keys, k)
+		}
+		seen[code] = true
+		c.codes = append(c.codes, code)
+	}
+	if c.LongPress != nil || c.DoubleTap != nil || c.Repeat {
+		return fmt.Errorf("combo %v: gestures can't be used in combos", c.Keys)
+	}
+	if err := c.Action.validate(); err != nil {
+		return fmt.Errorf("combo %v: %w", c.Keys, err)
+	}
+	return nil
+}
+
+func (c *Combo) has(code int) bool {
+	for _, k := range c.codes {
+		if k == code {
+			return true
+		}
+	}
+	return false
+}
+
+// comboState tracks the keys that may become part of a combo.
+type comboState struct {
+	// pending keys are pressed but not yet passed on, in press order.
+	pending []int
+	timer   *time.Timer
+	gen     int
+	// active is the combo held down, its keys are suppressed until they
+	// are released.
+	active     *Combo
+	activeEnv  actionEnv
+	suppressed map[int]bool
+}
+
+// handler builtins, they change the state of the handler.
+var handlerBuiltins = map[string]func(h *handler){
+	// toggle-pointer-mode switches between the absolute pointer and the
+	// air mouse.
+	"toggle-pointer-mode": func(h *handler) {
+		c := h.mapping.pointer(h.profiles.profile())
+		switch {
+		case h.pointerMode != "":
+			h.pointerMode = ""
+		case c.mode() == pointerAbsolute:
+			h.pointerMode = pointerGyro
+		default:
+			h.pointerMode = pointerAbsolute
+		}
+		mode := h.pointerMode
+		if mode == "" {
+			mode = c.mode()
+		}
+		log.Printf("pointer: %s mode", mode)
+	},
+	// drag-lock holds the left button down until it runs again.
+	"drag-lock": func(h *handler) {
+		h.setDragLock(!h.dragLocked)
+	},
+	// lock-input ignores the remote until it runs again, and stops the
+	// macros.
+	"lock-input": func(h *handler) {
+		h.locked = !h.locked
+		if h.locked {
+			stopMacros()
+			log.Printf("input: locked")
+		} else {
+			log.Printf("input: unlocked")
+		}
+	},
+}
+
+// run presses or releases a, with h.mu held.
+func (h *handler) run(a Action, pressed bool, env actionEnv) {
+	if f, ok := heldBuiltins[a.Builtin]; ok {
+		f(h, pressed)
+		return
+	}
+	if f, ok := handlerBuiltins[a.Builtin]; ok {
+		if pressed {
+			f(h)
+		}
+		return
+	}
+	a.run(h.sink, pressed, env)
+}
+
+// tap presses and releases a, with h.mu held.
+func (h *handler) tap(a Action, env actionEnv) {
+	h.run(a, true, env)
+	h.run(a, false, env)
+}
+
+// env returns the environment of an action run for the keys in the
+// current profile.
+func (h *handler) env(keys ...int) actionEnv {
+	return actionEnv{keys: keys, profile: h.profiles.profile().Name}
+}
+
+// key handles a remote key press or release. Keys that are part of a combo
+// are held back for the combo time, so a combo can fire instead of them.
+func (h *handler) key(code int, pressed bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	cs := &h.combos
+
+	if _, ok := multiTapLetters[code]; ok && h.text.active && !h.locked && !h.held[code] {
+		if pressed {
+			h.flushCombo()
+			h.multiTap(code)
+		}
+		return
+	}
+	if pressed {
+		h.held[code] = true
+	} else {
+		delete(h.held, code)
+	}
+
+	if !pressed {
+		if cs.suppressed[code] {
+			delete(cs.suppressed, code)
+			if cs.active != nil && cs.active.has(code) {
+				h.run(cs.active.Action, false, cs.activeEnv)
+				cs.active = nil
+			}
+			return
+		}
+		if h.pendingCombo(code) {
+			h.flushCombo()
+		}
+		h.gesture(code, false)
+		return
+	}
+
+	if cs.suppressed[code] || h.pendingCombo(code) {
+		// A repeated down event while held.
+		return
+	}
+	if !h.inCombo(code) {
+		h.flushCombo()
+		h.gesture(code, true)
+		return
+	}
+
+	cs.pending = append(cs.pending, code)
+	for i := range h.mapping.Combos {
+		c := &h.mapping.Combos[i]
+		if !h.comboPressed(c) || h.locked && c.Builtin != "lock-input" {
+			continue
+		}
+		h.stopCombo()
+		var rest []int
+		for _, k := range cs.pending {
+			if c.has(k) {
+				cs.suppressed[k] = true
+			} else {
+				rest = append(rest, k)
+			}
+		}
+		cs.pending = rest
+		h.flushCombo()
+		cs.active = c
+		cs.activeEnv = h.env(c.codes...)
+		h.run(c.Action, true, cs.activeEnv)
+		return
+	}
+
+	if cs.timer == nil {
+		gen := cs.gen
+		cs.timer = time.AfterFunc(h.mapping.Gestures.combo(), func() {
+			h.mu.Lock()
+			defer h.mu.Unlock()
+			if cs.gen == gen {
+				h.flushCombo()
+			}
+		})
+	}
+}
+
+// inCombo reports whether code is one of the keys of a combo.
+func (h *handler) inCombo(code int) bool {
+	for i := range h.mapping.Combos {
+		if h.mapping.Combos[i].has(code) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *handler) pendingCombo(code int) bool {
+	for _, k := range h.combos.pending {
+		if k == code {
+			return true
+		}
+	}
+	return false
+}
+
+// comboPressed reports whether all keys of c are pending.
+func (h *handler) comboPressed(c *Combo) bool {
+	for _, k := range c.codes {
+		if !h.pendingCombo(k) {
+			return false
+		}
+	}
+	return true
+}
+
+func (h *handler) stopCombo() {
+	cs := &h.combos
+	cs.gen++
+	if cs.timer != nil {
+		cs.timer.Stop()
+		cs.timer = nil
+	}
+}
+
+// flushCombo passes the pending keys on, no combo fired for them.
+func (h *handler) flushCombo() {
+	h.stopCombo()
+	pending := h.combos.pending
+	h.combos.pending = nil
+	for _, k := range pending {
+		h.gesture(k, true)
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// defaultDBusTimeout bounds D-Bus calls without a timeout of their own.
+const defaultDBusTimeout = 5 * time.Second
+
+// actionEnv describes what triggered an action. Commands get it in their
+// environment as M4P_KEYCODE, the remote keycodes separated by commas, and
+// M4P_PROFILE.
+type actionEnv struct {
+	keys    []int
+	profile string
+}
+
+func (e actionEnv) environ() []string {
+	codes := make([]string, len(e.keys))
+	for i, k := range e.keys {
+		codes[i] = strconv.Itoa(k)
+	}
+	return append(os.Environ(),
+		"M4P_KEYCODE="+strings.Join(codes, ","),
+		"M4P_PROFILE="+e.profile,
+	)
+}
+
+// commandWaitDelay is how long the output of an exited command is still
+// read. Children it left running, or that survived a timeout where process
+// groups aren't available, may hold its output open for much longer.
+const commandWaitDelay = time.Second
+
+// startCommand runs argv in the background with env added to its
+// environment. It is killed once timeout passes, if set.
+func startCommand(argv []string, env actionEnv, timeout time.Duration) {
+	go func() {
+		out, err := runCommand(argv, env, timeout)
+		switch {
+		case err != nil && len(out) > 0:
+			log.Printf("command %v: %v: %s", argv, err, out)
+		case err != nil:
+			log.Printf("command %v: %v", argv, err)
+		}
+	}()
+}
+
+// runCommand runs argv with env added to its environment and returns its
+// output. It is killed once timeout passes, if set.
+func runCommand(argv []string, env actionEnv, timeout time.Duration) ([]byte, error) {
+	cmd := exec.Command(argv[0], argv[1:]...)
+	cmd.Env = env.environ()
+	// With an *os.File as output Wait doesn't wait for the output to be
+	// read, the pipe is read here instead and closed once the command
+	// exited and commandWaitDelay passed.
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	cmd.Stdout = w
+	cmd.Stderr = w
+	setProcessGroup(cmd)
+	err = cmd.Start()
+	w.Close()
+	if err != nil {
+		r.Close()
+		return nil, err
+	}
+	var out bytes.Buffer
+	copied := make(chan struct{})
+	go func() {
+		io.Copy(&out, r)
+		close(copied)
+	}()
+
+	var timedOut int32
+	if timeout > 0 {
+		t := time.AfterFunc(timeout, func() {
+			atomic.StoreInt32(&timedOut, 1)
+			killProcessGroup(cmd)
+		})
+		defer t.Stop()
+	}
+	err = cmd.Wait()
+	t := time.NewTimer(commandWaitDelay)
+	select {
+	case <-copied:
+	case <-t.C:
+	}
+	t.Stop()
+	r.Close()
+	<-copied
+
+	if atomic.LoadInt32(&timedOut) == 1 {
+		err = fmt.Errorf("timed out after %v", timeout)
+	}
+	return out.Bytes(), err
+}
+
+// DBusCall is a D-Bus method call, made with dbus-send.
+type DBusCall struct {
+	// Bus is session, the default, or system.
+	Bus string `json:"bus,omitempty"`
+	// Dest is the bus name of the service, e.g. org.freedesktop.login1.
+	Dest string `json:"dest"`
+	// Path is the object path, e.g. /org/freedesktop/login1.
+	Path string `json:"path"`
+	// Method is the interface and member, e.g.
+	// org.freedesktop.login1.Manager.Suspend.
+	Method string `json:"method"`
+	// Args in dbus-send notation, e.g. "boolean:true" or "string:Master".
+	Args []string `json:"args,omitempty"`
+}
+
+// dbusArgTypes are the argument types dbus-send accepts.
+var dbusArgTypes = map[string]bool{
+	"string": true, "int16": true, "uint16": true, "int32": true, "uint32": true,
+	"int64": true, "uint64": true, "double": true, "byte": true, "boolean": true,
+	"objpath": true, "variant": true, "array": true, "dict": true,
+}
+
+func (c *DBusCall) validate() error {
+	switch c.Bus {
+	case "", "session", "system":
+	default:
+		return fmt.Errorf("dbus: unknown bus %q, use session or system", c.Bus)
+	}
+	if c.Dest == "" || !strings.HasPrefix(c.Path, "/") {
+		return fmt.Errorf("dbus: dest and an absolute path are required")
+	}
+	if i := strings.LastIndexByte(c.Method, '.'); i <= 0 || i == len(c.Method)-1 {
+		return fmt.Errorf("dbus: method %q must be interface.Member", c.Method)
+	}
+	for _, a := range c.Args {
+		typ := a
+		if i := strings.IndexByte(a, ':'); i >= 0 {
+			typ = a[:i]
+		}
+		if !dbusArgTypes[typ] {
+			return fmt.Errorf("dbus: argument %q must be type:value", a)
+		}
+	}
+	return nil
+}
+
+// argv returns the dbus-send command line for the call.
+func (c *DBusCall) argv(timeout time.Duration) []string {
+	bus := c.Bus
+	if bus == "" {
+		bus = "session"
+	}
+	argv := []string{
+		"dbus-send", "--" + bus, "--print-reply", "--type=method_call",
+		fmt.Sprintf("--reply-timeout=%d", timeout.Milliseconds()),
+		"--dest=" + c.Dest, c.Path, c.Method,
+	}
+	return append(argv, c.Args...)
+}
+
+// start makes the call in the background.
+func (c *DBusCall) start(env actionEnv, timeout time.Duration) {
+	if timeout <= 0 {
+		timeout = defaultDBusTimeout
+	}
+	// dbus-send gives up on its own, the extra second covers a bus that
+	// doesn't answer at all.
+	startCommand(c.argv(timeout), env, timeout+time.Second)
+}
+
+// output makes the call and returns the reply as printed by dbus-send.
+func (c *DBusCall) output(timeout time.Duration) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout+time.Second)
+	defer cancel()
+	argv := c.argv(timeout)
+	out, err := exec.CommandContext(ctx, argv[0], argv[1:]...).Output()
+	return string(out), err
+}
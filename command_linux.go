@@ -0,0 +1,23 @@
+//go:build linux
+
+package main
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// shellCommand returns the argv running script with the system shell.
+func shellCommand(script string) []string {
+	return []string{"/bin/sh", "-c", script}
+}
+
+// setProcessGroup starts cmd in a process group of its own, so a timeout
+// kills the children of a shell script too.
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+func killProcessGroup(cmd *exec.Cmd) {
+	syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
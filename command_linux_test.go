@@ -0,0 +1,47 @@
+//go:build linux
+
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunCommand(t *testing.T) {
+	env := actionEnv{keys: []int{403, 404}, profile: "desktop"}
+	out, err := runCommand(shellCommand("echo $M4P_KEYCODE $M4P_PROFILE"), env, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(string(out)); got != "403,404 desktop" {
+		t.Errorf("got output %q, want %q", got, "403,404 desktop")
+	}
+}
+
+func TestRunCommandTimeout(t *testing.T) {
+	start := time.Now()
+	_, err := runCommand(shellCommand("sleep 30"), actionEnv{}, 100*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("got error %v, want a timeout", err)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Errorf("took %v to time out", d)
+	}
+}
+
+func TestRunCommandLeftoverChild(t *testing.T) {
+	// The child keeps the output open after the shell exited, as a child
+	// that survived the kill does on Windows.
+	start := time.Now()
+	out, err := runCommand(shellCommand("sleep 5 & echo started"), actionEnv{}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(string(out)); got != "started" {
+		t.Errorf("got output %q, want %q", got, "started")
+	}
+	if d := time.Since(start); d > commandWaitDelay+3*time.Second {
+		t.Errorf("took %v, the leftover child held it up", d)
+	}
+}
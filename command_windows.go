@@ -0,0 +1,17 @@
+//go:build windows
+
+package main
+
+import "os/exec"
+
+// shellCommand returns the argv running script with the system shell.
+func shellCommand(script string) []string {
+	return []string{"cmd", "/C", script}
+}
+
+// setProcessGroup does nothing, a timeout only kills the process itself.
+func setProcessGroup(cmd *exec.Cmd) {}
+
+func killProcessGroup(cmd *exec.Cmd) {
+	cmd.Process.Kill()
+}
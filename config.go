@@ -0,0 +1,406 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/netham45/magic4pc_altclient/m4p"
+)
+
+// Log levels.
+const (
+	logDebug = "debug"
+	logInfo  = "info"
+)
+
+// debugLog enables the logs of every key press and message.
+var debugLog = false
+
+func debugf(format string, v ...interface{}) {
+	if debugLog {
+		log.Printf(format, v...)
+	}
+}
+
+// Config is the client configuration. It is read from a JSON file, flags
+// override the file.
+type Config struct {
+	// TV is the address of the TV, it is discovered through broadcasts when
+	// empty.
+	TV   string `json:"tv,omitempty"`
+	Port int    `json:"port"`
+	// Discover forces discovery even if TV is set.
+	Discover  bool            `json:"discover,omitempty"`
+	Discovery DiscoveryConfig `json:"discovery"`
+	// LocalPort is the UDP port the client sends from, 0 picks a free one.
+	LocalPort int `json:"localPort"`
+	// LocalAddr is the IP address the client sends from.
+	LocalAddr string `json:"localAddr,omitempty"`
+	// Interface sends from an address of this network interface.
+	Interface string `json:"interface,omitempty"`
+	// Network is udp4, udp6 or udp for either IP version.
+	Network string `json:"network"`
+	// ListenAddr is where stray UDP packets from the TV are logged, empty
+	// disables the listener.
+	ListenAddr string `json:"listenAddr"`
+	// UpdateFrequency of the remote's sensor updates.
+	UpdateFrequency int `json:"updateFrequency"`
+	// Sensors are the m4p filters the TV sends, see m4p.DefaultFilters.
+	Sensors []string `json:"sensors"`
+	// RetryInterval is the first delay before reconnecting, it doubles
+	// with every failed attempt up to MaxRetryInterval.
+	RetryInterval    duration `json:"retryInterval"`
+	MaxRetryInterval duration `json:"maxRetryInterval"`
+
+	Backend      string       `json:"backend"`
+	UinputDevice string       `json:"uinputDevice"`
+	Output       OutputConfig `json:"output"`
+	// Mapping is a key mapping file, relative to the config file.
+	Mapping  string `json:"mapping,omitempty"`
+	LogLevel string `json:"logLevel"`
+
+	// TVs lists several TVs to drive at once. The settings above are used
+	// for a single TV when it's empty.
+	TVs []TVConfig `json:"tvs,omitempty"`
+}
+
+// TVConfig is one of several TVs driven by the client. Unset fields inherit
+// from the top level of the config.
+type TVConfig struct {
+	Name string `json:"name"`
+	// Address of the TV, it is discovered through broadcasts when empty.
+	Address string `json:"address,omitempty"`
+	Port    int    `json:"port,omitempty"`
+	// Model and MAC select the TV when discovered. Without them each TV is
+	// the first one advertising that isn't driven yet.
+	Model string `json:"model,omitempty"`
+	MAC   string `json:"mac,omitempty"`
+	// LocalPort defaults to a free port, so the TVs don't share one.
+	LocalPort *int         `json:"localPort,omitempty"`
+	Output    OutputConfig `json:"output"`
+	Mapping   string       `json:"mapping,omitempty"`
+}
+
+// tvs returns the TVs to drive with the inherited settings filled in.
+func (c *Config) tvs() []TVConfig {
+	if len(c.TVs) == 0 {
+		tv := TVConfig{
+			Name:      "tv",
+			Address:   c.TV,
+			Port:      c.Port,
+			Model:     c.Discovery.Model,
+			MAC:       c.Discovery.MAC,
+			LocalPort: &c.LocalPort,
+			Output:    c.Output,
+			Mapping:   c.Mapping,
+		}
+		if c.Discover {
+			tv.Address = ""
+		}
+		return []TVConfig{tv}
+	}
+
+	tvs := make([]TVConfig, len(c.TVs))
+	for i, tv := range c.TVs {
+		if tv.Port == 0 {
+			tv.Port = c.Port
+		}
+		if tv.LocalPort == nil {
+			tv.LocalPort = new(int)
+		}
+		if tv.Output == (OutputConfig{}) {
+			tv.Output = c.Output
+		}
+		if tv.Mapping == "" {
+			tv.Mapping = c.Mapping
+		}
+		tvs[i] = tv
+	}
+	return tvs
+}
+
+// DiscoveryConfig selects the TV among the ones advertising themselves.
+type DiscoveryConfig struct {
+	Model string `json:"model,omitempty"`
+	MAC   string `json:"mac,omitempty"`
+	// Port the TV broadcasts magic4pc_ad messages to.
+	Port int `json:"port"`
+}
+
+func defaultConfig() *Config {
+	return &Config{
+		Port:             m4p.DefaultPort,
+		Discovery:        DiscoveryConfig{Port: m4p.DefaultBroadcastPort},
+		LocalPort:        m4p.DefaultLocalPort,
+		Network:          "udp4",
+		ListenAddr:       "0.0.0.0:9105",
+		UpdateFrequency:  m4p.DefaultUpdateFrequency,
+		Sensors:          append([]string(nil), m4p.DefaultFilters...),
+		RetryInterval:    duration(2 * time.Second),
+		MaxRetryInterval: duration(time.Minute),
+		Backend:          defaultBackend,
+		UinputDevice:     "/dev/uinput",
+		LogLevel:         logInfo,
+	}
+}
+
+// defaultConfigPath is config.json in the user's config directory, e.g.
+// ~/.config/magic4pc/config.json.
+func defaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "magic4pc", "config.json")
+}
+
+// loadConfig applies the config file at path to the defaults. A missing
+// file is only an error if it was asked for explicitly.
+func loadConfig(path string, explicit bool) (*Config, error) {
+	c := defaultConfig()
+	if path == "" {
+		return c, nil
+	}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && !explicit {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, c); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	c.Mapping = relativeTo(path, c.Mapping)
+	for i := range c.TVs {
+		c.TVs[i].Mapping = relativeTo(path, c.TVs[i].Mapping)
+	}
+	return c, nil
+}
+
+// relativeTo resolves a path relative to the directory of the config file.
+func relativeTo(config, path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(filepath.Dir(config), path)
+}
+
+func (c *Config) validate() error {
+	switch c.LogLevel {
+	case logDebug, logInfo:
+	default:
+		return fmt.Errorf("unknown log level %q", c.LogLevel)
+	}
+	if _, err := m4p.NewLayout(c.Sensors); err != nil {
+		return err
+	}
+	switch c.Network {
+	case "udp", "udp4", "udp6":
+	default:
+		return fmt.Errorf("unknown network %q", c.Network)
+	}
+	if c.UpdateFrequency <= 0 {
+		return fmt.Errorf("update frequency must be positive")
+	}
+	if c.RetryInterval <= 0 {
+		return fmt.Errorf("retry interval must be positive")
+	}
+	if c.MaxRetryInterval < c.RetryInterval {
+		return fmt.Errorf("max retry interval must not be below the retry interval")
+	}
+
+	if len(c.TVs) > 0 {
+		// These select the single TV, from the config file or the command
+		// line, and would be ignored.
+		for _, f := range []struct {
+			name, flag string
+			set        bool
+			hint       string
+		}{
+			{"tv", "the ip argument", c.TV != "", "set address on each of the tvs"},
+			{"discover", "-discover", c.Discover, "leave out the address of the tvs to discover"},
+			{"discovery.model", "-model", c.Discovery.Model != "", "set model on each of the tvs"},
+			{"discovery.mac", "-mac", c.Discovery.MAC != "", "set mac on each of the tvs"},
+		} {
+			if f.set {
+				return fmt.Errorf("%s (%s) can't be used with tvs, %s", f.name, f.flag, f.hint)
+			}
+		}
+	}
+
+	names := make(map[string]bool, len(c.TVs))
+	ports := make(map[int]string, len(c.TVs))
+	for _, tv := range c.TVs {
+		if tv.Name == "" {
+			return fmt.Errorf("tv without name")
+		}
+		if names[tv.Name] {
+			return fmt.Errorf("duplicate tv %s", tv.Name)
+		}
+		names[tv.Name] = true
+		if tv.Address != "" && (tv.Model != "" || tv.MAC != "") {
+			return fmt.Errorf("tv %s: model and mac only select a discovered TV, they can't be used with an address", tv.Name)
+		}
+		if tv.LocalPort != nil && *tv.LocalPort != 0 {
+			if other, ok := ports[*tv.LocalPort]; ok {
+				return fmt.Errorf("tvs %s and %s both use local port %d", other, tv.Name, *tv.LocalPort)
+			}
+			ports[*tv.LocalPort] = tv.Name
+		}
+	}
+	return nil
+}
+
+// errUsage is returned for bad flags, the flag set has already reported
+// them.
+var errUsage = errors.New("invalid usage")
+
+// clientFlags are the flags that aren't part of the config.
+type clientFlags struct {
+	config       string
+	printConfig  bool
+	printMapping bool
+}
+
+// bindFlags defines the flags on fs, with the values in c as defaults.
+func (c *Config) bindFlags(fs *flag.FlagSet, cf *clientFlags) {
+	fs.StringVar(&cf.config, "config", defaultConfigPath(), "config file (JSON)")
+	fs.BoolVar(&cf.printConfig, "print-config", false, "print the effective config and exit")
+	fs.BoolVar(&cf.printMapping, "print-mapping", false, "print the default key mapping and exit")
+
+	fs.BoolVar(&c.Discover, "discover", c.Discover, "find the TV through magic4pc_ad broadcasts (default when no ip is given)")
+	fs.StringVar(&c.Discovery.Model, "model", c.Discovery.Model, "only use a discovered TV with this model")
+	fs.StringVar(&c.Discovery.MAC, "mac", c.Discovery.MAC, "only use a discovered TV with this MAC address")
+	fs.IntVar(&c.Discovery.Port, "broadcast-port", c.Discovery.Port, "port the TV broadcasts magic4pc_ad messages to")
+	fs.IntVar(&c.LocalPort, "local-port", c.LocalPort, "local UDP port to connect from, 0 for any free port")
+	fs.StringVar(&c.LocalAddr, "local-addr", c.LocalAddr, "local IP address to connect from")
+	fs.StringVar(&c.Interface, "interface", c.Interface, "network interface to connect from")
+	fs.StringVar(&c.Network, "network", c.Network, "IP version to connect with: udp4, udp6 or udp for either")
+	fs.StringVar(&c.ListenAddr, "listen", c.ListenAddr, "address to log stray UDP packets on, empty to disable")
+	fs.IntVar(&c.UpdateFrequency, "update-frequency", c.UpdateFrequency, "sensor update frequency requested from the TV")
+	fs.Var((*stringList)(&c.Sensors), "sensors", "comma separated sensor filters requested from the TV")
+	fs.Var(&c.RetryInterval, "retry", "first delay before reconnecting")
+	fs.Var(&c.MaxRetryInterval, "max-retry", "longest delay before reconnecting")
+
+	fs.StringVar(&c.Backend, "backend", c.Backend, "input backend: "+strings.Join(sinkNames(), ", "))
+	fs.StringVar(&c.UinputDevice, "uinput-device", c.UinputDevice, "uinput device used by the uinput backend")
+	fs.StringVar(&c.Output.Name, "output", c.Output.Name, "monitor the TV pointer covers, by name, index or as WxH+X+Y (default the whole desktop)")
+	fs.IntVar(&c.Output.OffsetX, "offset-x", c.Output.OffsetX, "shift the TV pointer right by this many pixels")
+	fs.IntVar(&c.Output.OffsetY, "offset-y", c.Output.OffsetY, "shift the TV pointer down by this many pixels")
+	fs.BoolVar(&c.Output.Letterbox, "letterbox", c.Output.Letterbox, "keep the TV's 16:9 aspect ratio on the target monitor instead of stretching")
+	fs.StringVar(&c.Mapping, "mapping", c.Mapping, "key mapping file (JSON), applied on top of the default mapping")
+	fs.StringVar(&c.LogLevel, "log-level", c.LogLevel, "log level: debug or info")
+}
+
+// parseConfig reads the config file and applies the flags and positional
+// [ip [port]] arguments in args on top of it.
+func parseConfig(name string, args []string, output io.Writer) (*Config, clientFlags, error) {
+	newFlagSet := func(c *Config, cf *clientFlags) *flag.FlagSet {
+		fs := flag.NewFlagSet(name, flag.ContinueOnError)
+		fs.SetOutput(output)
+		c.bindFlags(fs, cf)
+		fs.Usage = func() {
+			fmt.Fprintf(fs.Output(), "Usage: %s [flags] [ip [port]]\n", name)
+			fs.PrintDefaults()
+		}
+		return fs
+	}
+
+	// The first pass only finds the config file, the second applies the
+	// flags on top of it and shows its values as defaults in the usage.
+	// Errors are reported by the second pass.
+	var cf clientFlags
+	fs := newFlagSet(defaultConfig(), &cf)
+	fs.SetOutput(io.Discard)
+	_ = fs.Parse(args)
+	explicit := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "config" {
+			explicit = true
+		}
+	})
+	c, err := loadConfig(cf.config, explicit)
+	if err != nil {
+		return nil, cf, err
+	}
+
+	fs = newFlagSet(c, &cf)
+	if err := fs.Parse(args); err == flag.ErrHelp {
+		return nil, cf, err
+	} else if err != nil {
+		return nil, cf, errUsage
+	}
+	if fs.NArg() > 0 {
+		c.TV = fs.Arg(0)
+	}
+	if fs.NArg() > 1 {
+		c.Port, err = strconv.Atoi(fs.Arg(1))
+		if err != nil {
+			return nil, cf, fmt.Errorf("invalid port: %v", err)
+		}
+	}
+	if fs.NArg() > 2 {
+		fmt.Fprintln(fs.Output(), "too many arguments")
+		fs.Usage()
+		return nil, cf, errUsage
+	}
+	return c, cf, c.validate()
+}
+
+// duration is a time.Duration written as a string like "2s" in JSON.
+type duration time.Duration
+
+func (d duration) String() string {
+	return time.Duration(d).String()
+}
+
+func (d *duration) Set(s string) error {
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = duration(v)
+	return nil
+}
+
+func (d duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	return d.Set(s)
+}
+
+// stringList is a comma separated list flag.
+type stringList []string
+
+func (l *stringList) String() string {
+	if l == nil {
+		return ""
+	}
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(s string) error {
+	*l = nil
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*l = append(*l, v)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// parseTestConfig parses args with config as the config file.
+func parseTestConfig(t *testing.T, config string, args ...string) (*Config, error) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	c, _, err := parseConfig("magic4pc", append([]string{"-config", path}, args...), io.Discard)
+	return c, err
+}
+
+func TestParseConfig(t *testing.T) {
+	c, err := parseTestConfig(t, `{"tv": "192.168.1.50", "backend": "noop", "retryInterval": "5s", "mapping": "keys.json"}`,
+		"-backend", "record", "-sensors", "coordinate,gyroscope")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.TV != "192.168.1.50" || time.Duration(c.RetryInterval) != 5*time.Second {
+		t.Errorf("config file not applied: tv %q, retry %v", c.TV, c.RetryInterval)
+	}
+	if c.Backend != "record" {
+		t.Errorf("backend = %q, want the flag's record", c.Backend)
+	}
+	if strings.Join(c.Sensors, ",") != "coordinate,gyroscope" {
+		t.Errorf("sensors = %v", c.Sensors)
+	}
+	if !filepath.IsAbs(c.Mapping) || filepath.Base(c.Mapping) != "keys.json" {
+		t.Errorf("mapping = %q, want keys.json next to the config file", c.Mapping)
+	}
+
+	// The arguments override the address and port of the file.
+	c, err = parseTestConfig(t, `{"tv": "192.168.1.50"}`, "192.168.1.51", "42000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.TV != "192.168.1.51" || c.Port != 42000 {
+		t.Errorf("tv = %s:%d, want 192.168.1.51:42000", c.TV, c.Port)
+	}
+}
+
+func TestParseConfigErrors(t *testing.T) {
+	tests := []struct {
+		config string
+		args   []string
+	}{
+		{`{"logLevel": "trace"}`, nil},
+		{`{"sensors": ["magnetometer"]}`, nil},
+		{`{"updateFrequency": 0}`, nil},
+		{`{"retryInterval": "0s"}`, nil},
+		{`{"retryInterval": "soon"}`, nil},
+		{`{}`, []string{"192.168.1.50", "port"}},
+		{`{}`, []string{"192.168.1.50", "42000", "extra"}},
+		{`{}`, []string{"-nosuchflag"}},
+	}
+	for _, tt := range tests {
+		if _, err := parseTestConfig(t, tt.config, tt.args...); err == nil {
+			t.Errorf("%s %v: no error", tt.config, tt.args)
+		}
+	}
+}
+
+const twoTVs = `{"tvs": [{"name": "lounge", "mac": "a8:23:fe:00:00:01"}, {"name": "bedroom", "address": "192.168.1.51"}]}`
+
+func TestParseConfigTVFlags(t *testing.T) {
+	tests := []struct {
+		config string
+		args   []string
+		err    string
+	}{
+		{`{}`, []string{"-model", "OLED55C1", "192.168.1.50", "42831"}, ""},
+		{twoTVs, []string{"-backend", "noop"}, ""},
+		{twoTVs, []string{"192.168.1.50"}, "the ip argument"},
+		{twoTVs, []string{"-model", "OLED55C1"}, "-model"},
+		{twoTVs, []string{"-mac", "a8:23:fe:00:00:02"}, "-mac"},
+		{twoTVs, []string{"-discover"}, "-discover"},
+	}
+	for _, tt := range tests {
+		_, err := parseTestConfig(t, tt.config, tt.args...)
+		switch {
+		case tt.err == "" && err != nil:
+			t.Errorf("%s %v: %v", tt.config, tt.args, err)
+		case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+			t.Errorf("%s %v: got error %v, want one about %s", tt.config, tt.args, err, tt.err)
+		}
+	}
+}
+
+func TestConfigTVConflicts(t *testing.T) {
+	tests := []struct {
+		config string
+		err    string
+	}{
+		{`{"discovery": {"model": "OLED55C1"}, "tvs": [{"name": "lounge"}]}`, "discovery.model"},
+		{`{"discovery": {"mac": "a8:23:fe:00:00:01"}, "tvs": [{"name": "lounge"}]}`, "discovery.mac"},
+		{`{"tv": "192.168.1.50", "tvs": [{"name": "lounge"}]}`, "tv (the ip argument)"},
+		{`{"discover": true, "tvs": [{"name": "lounge"}]}`, "discover"},
+		{`{"tvs": [{"name": "lounge", "address": "192.168.1.50", "mac": "a8:23:fe:00:00:01"}]}`, "tv lounge"},
+		{`{"discovery": {"model": "OLED55C1", "port": 42830}}`, ""},
+	}
+	for _, tt := range tests {
+		_, err := parseTestConfig(t, tt.config)
+		switch {
+		case tt.err == "" && err != nil:
+			t.Errorf("%s: %v", tt.config, err)
+		case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+			t.Errorf("%s: got error %v, want one about %s", tt.config, err, tt.err)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/netham45/magic4pc_altclient/m4p"
+)
+
+// reconnectJitter randomizes the reconnect delays by ±20%.
+const reconnectJitter = 0.2
+
+// tvConn keeps a TV connected, reconnecting with exponential backoff.
+type tvConn struct {
+	cfg     *Config
+	tv      TVConfig
+	tracker *deviceTracker // nil for a TV at a fixed address.
+	h       *handler
+	backoff m4p.Backoff
+
+	mu    sync.Mutex
+	state m4p.State
+	// connected is set once the current attempt reached the server.
+	connected bool
+	// quiet logs at debug level while reconnects keep failing, e.g. all
+	// night while the TV is in standby.
+	quiet bool
+}
+
+func newTVConn(cfg *Config, tv TVConfig, tracker *deviceTracker, h *handler) *tvConn {
+	return &tvConn{
+		cfg:     cfg,
+		tv:      tv,
+		tracker: tracker,
+		h:       h,
+		backoff: m4p.Backoff{
+			Min:    time.Duration(cfg.RetryInterval),
+			Max:    time.Duration(cfg.MaxRetryInterval),
+			Jitter: reconnectJitter,
+		},
+	}
+}
+
+func (c *tvConn) logf(format string, v ...interface{}) {
+	c.mu.Lock()
+	quiet := c.quiet
+	c.mu.Unlock()
+	if quiet {
+		debugf(c.tv.Name+": "+format, v...)
+	} else {
+		log.Printf(c.tv.Name+": "+format, v...)
+	}
+}
+
+// setState records and logs a state change, it is also called by the
+// m4p client.
+func (c *tvConn) setState(s m4p.State, err error) {
+	c.mu.Lock()
+	if s == c.state {
+		c.mu.Unlock()
+		return
+	}
+	c.state = s
+	if s == m4p.StateConnected {
+		c.connected = true
+		c.quiet = false
+	}
+	c.mu.Unlock()
+
+	if err != nil {
+		c.logf("%v: %v", s, err)
+	} else {
+		c.logf("%v", s)
+	}
+}
+
+// run connects to the TV until ctx is done.
+func (c *tvConn) run(ctx context.Context) {
+	for {
+		dev := m4p.DeviceInfo{IPAddr: c.tv.Address, Port: c.tv.Port}
+		var changed <-chan struct{}
+		if c.tracker != nil {
+			if c.tracker.free() {
+				c.setState(m4p.StateDiscovering, nil)
+			}
+			var err error
+			dev, changed, err = c.tracker.wait(ctx)
+			if err != nil {
+				return
+			}
+		}
+
+		connCtx, cancel := context.WithCancel(ctx)
+		go func() {
+			select {
+			case <-changed:
+				cancel()
+			case <-connCtx.Done():
+			}
+		}()
+		err := c.connect(connCtx, dev)
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+
+		select {
+		case <-changed:
+			// Reconnect to the new address right away.
+			continue
+		default:
+		}
+		c.wait(ctx, err, changed)
+	}
+}
+
+// wait backs off after a failed or lost connection. The wait ends early
+// when the TV moves to a new address, closing changed, or advertises itself
+// after it went silent, e.g. waking up from standby. A TV refusing the
+// connection keeps advertising, that doesn't shorten the wait.
+func (c *tvConn) wait(ctx context.Context, err error, changed <-chan struct{}) {
+	c.mu.Lock()
+	connected := c.connected
+	c.connected = false
+	c.mu.Unlock()
+	if connected {
+		c.backoff.Reset()
+	}
+
+	d := c.backoff.Next()
+	c.setState(m4p.StateBackoff, fmt.Errorf("retrying in %v: %w", d.Round(100*time.Millisecond), err))
+	if !connected {
+		c.mu.Lock()
+		if !c.quiet {
+			log.Printf("%s: not reachable, further attempts are logged at debug level", c.tv.Name)
+		}
+		c.quiet = true
+		c.mu.Unlock()
+	}
+
+	var advertised <-chan struct{}
+	if c.tracker != nil && errors.Is(err, m4p.ErrServerTimeout) {
+		// Only advertisements after the disconnect count.
+		select {
+		case <-c.tracker.advertised:
+		default:
+		}
+		advertised = c.tracker.advertised
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+	case <-t.C:
+	case <-changed:
+		c.logf("moved, reconnecting")
+	case <-advertised:
+		c.logf("advertised, reconnecting")
+	}
+}
+
+func (c *tvConn) connect(ctx context.Context, dev m4p.DeviceInfo) error {
+	addr := net.JoinHostPort(dev.IPAddr, strconv.Itoa(dev.Port))
+	c.logf("hola! connecting to: %s", addr)
+
+	client, err := m4p.Dial(ctx, addr,
+		m4p.WithNetwork(c.cfg.Network),
+		m4p.WithLocalAddr(c.cfg.LocalAddr),
+		m4p.WithInterface(c.cfg.Interface),
+		m4p.WithLocalPort(*c.tv.LocalPort),
+		m4p.WithUpdateFrequency(c.cfg.UpdateFrequency),
+		m4p.WithFilters(c.cfg.Sensors...),
+		m4p.WithStateFunc(c.setState),
+	)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	for {
+		m, err := client.Recv(ctx)
+		if err != nil {
+			var lenErr *m4p.PayloadLengthError
+			if errors.As(err, &lenErr) {
+				c.logf("connect: %v", err)
+				continue
+			}
+			return err
+		}
+
+		c.h.handle(m)
+	}
+}
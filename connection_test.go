@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/netham45/magic4pc_altclient/m4p"
+)
+
+// waitReturns reports whether c.wait returns within a short time after the
+// tracker saw an advertisement of the TV, or moved it if move is set.
+func waitReturns(t *testing.T, err error, move bool) bool {
+	t.Helper()
+	tracker := newDeviceTracker(deviceFilter{})
+	dev := m4p.DeviceInfo{Model: "OLED55C1", MAC: "a8:23:fe:00:00:01", IPAddr: "192.168.1.50", Port: m4p.DefaultPort}
+	tracker.update(dev)
+	_, changed, _ := tracker.wait(context.Background())
+
+	cfg := defaultConfig()
+	cfg.RetryInterval = duration(time.Hour)
+	cfg.MaxRetryInterval = duration(time.Hour)
+	c := newTVConn(cfg, TVConfig{Name: "tv"}, tracker, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		c.wait(ctx, err, changed)
+		close(done)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	if move {
+		dev.IPAddr = "192.168.1.51"
+	}
+	tracker.update(dev)
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(200 * time.Millisecond):
+		return false
+	}
+}
+
+func TestTVConnWait(t *testing.T) {
+	refused := fmt.Errorf("send keepalive: %w", syscall.ECONNREFUSED)
+	if waitReturns(t, refused, false) {
+		t.Error("an advertisement ended the backoff after the TV refused the connection")
+	}
+	if !waitReturns(t, refused, true) {
+		t.Error("moving to a new address didn't end the backoff")
+	}
+	if !waitReturns(t, m4p.ErrServerTimeout, false) {
+		t.Error("an advertisement didn't end the backoff after the TV went silent")
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+)
+
+// Control defaults.
+const (
+	defaultVolumeStep     = 5
+	defaultMaxVolume      = 100
+	defaultBrightnessStep = 10
+)
+
+// ControlsConfig holds the steps of the volume and brightness builtins, in
+// percent.
+type ControlsConfig struct {
+	VolumeStep int `json:"volumeStep,omitempty"`
+	// MaxVolume caps volume-up, above 100 amplifies.
+	MaxVolume      int `json:"maxVolume,omitempty"`
+	BrightnessStep int `json:"brightnessStep,omitempty"`
+}
+
+func (c ControlsConfig) merge(o ControlsConfig) ControlsConfig {
+	if o.VolumeStep != 0 {
+		c.VolumeStep = o.VolumeStep
+	}
+	if o.MaxVolume != 0 {
+		c.MaxVolume = o.MaxVolume
+	}
+	if o.BrightnessStep != 0 {
+		c.BrightnessStep = o.BrightnessStep
+	}
+	return c
+}
+
+func (c ControlsConfig) validate() error {
+	if c.VolumeStep < 0 || c.MaxVolume < 0 || c.BrightnessStep < 0 {
+		return fmt.Errorf("controls must not be negative")
+	}
+	return nil
+}
+
+func (c ControlsConfig) volumeStep() int {
+	return intOr(c.VolumeStep, defaultVolumeStep)
+}
+
+func (c ControlsConfig) maxVolume() int {
+	return intOr(c.MaxVolume, defaultMaxVolume)
+}
+
+func (c ControlsConfig) brightnessStep() int {
+	return intOr(c.BrightnessStep, defaultBrightnessStep)
+}
+
+func intOr(v, def int) int {
+	if v == 0 {
+		return def
+	}
+	return v
+}
+
+// errNoControl means the host has no tool for a control, its key is sent
+// instead.
+var errNoControl = errors.New("no control available")
+
+// control is a volume or brightness builtin and the keysym sent instead
+// when the host can't be controlled directly.
+type control struct {
+	run    func(c ControlsConfig) error
+	keysym string
+}
+
+// controls are the volume and brightness builtins.
+var controls = map[string]control{
+	"volume-up": {
+		run:    func(c ControlsConfig) error { return changeVolume(c.volumeStep(), c.maxVolume()) },
+		keysym: "XF86AudioRaiseVolume",
+	},
+	"volume-down": {
+		run:    func(c ControlsConfig) error { return changeVolume(-c.volumeStep(), c.maxVolume()) },
+		keysym: "XF86AudioLowerVolume",
+	},
+	"volume-mute": {
+		run:    func(ControlsConfig) error { return toggleMute() },
+		keysym: "XF86AudioMute",
+	},
+	"brightness-up": {
+		run:    func(c ControlsConfig) error { return changeBrightness(c.brightnessStep()) },
+		keysym: "XF86MonBrightnessUp",
+	},
+	"brightness-down": {
+		run:    func(c ControlsConfig) error { return changeBrightness(-c.brightnessStep()) },
+		keysym: "XF86MonBrightnessDown",
+	},
+}
+
+// controlMu runs one control at a time, brightness is read before it is
+// changed.
+var controlMu sync.Mutex
+
+func init() {
+	for name, c := range controls {
+		name, c := name, c
+		handlerBuiltins[name] = func(h *handler) {
+			s, cfg := h.sink, h.mapping.Controls
+			go func() {
+				controlMu.Lock()
+				err := c.run(cfg)
+				controlMu.Unlock()
+				switch {
+				case err == errNoControl:
+					debugf("%s: sending %s", name, c.keysym)
+					s.Key(c.keysym, true)
+					s.Key(c.keysym, false)
+				case err != nil:
+					log.Printf("%s: %v", name, err)
+				}
+			}()
+		}
+	}
+}
@@ -0,0 +1,148 @@
+//go:build linux
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// toolTimeout bounds a run of a volume or brightness tool, a second longer
+// than dbus-send waits for a reply on its own.
+const toolTimeout = defaultDBusTimeout + time.Second
+
+// The host tools the controls run, replaced in tests.
+var (
+	lookTool = func(name string) error {
+		_, err := exec.LookPath(name)
+		return err
+	}
+	toolOutput = func(timeout time.Duration, argv ...string) ([]byte, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		return exec.CommandContext(ctx, argv[0], argv[1:]...).CombinedOutput()
+	}
+	backlightGlob = "/sys/class/backlight/*"
+)
+
+// changeVolume changes the volume of the default sink by step percent, up
+// to max, with wpctl on PipeWire or pactl on PulseAudio.
+func changeVolume(step, max int) error {
+	sign := "+"
+	if step < 0 {
+		sign, step = "-", -step
+	}
+	if lookTool("wpctl") == nil {
+		return runTool("wpctl", "set-volume", "-l", fmt.Sprintf("%.2f", float64(max)/100),
+			"@DEFAULT_AUDIO_SINK@", fmt.Sprintf("%d%%%s", step, sign))
+	}
+	if lookTool("pactl") != nil {
+		return errNoControl
+	}
+	if err := runTool("pactl", "set-sink-volume", "@DEFAULT_SINK@", fmt.Sprintf("%s%d%%", sign, step)); err != nil {
+		return err
+	}
+	if sign == "-" {
+		return nil
+	}
+	// pactl has no limit of its own.
+	out, err := toolOutput(toolTimeout, "pactl", "get-sink-volume", "@DEFAULT_SINK@")
+	if err != nil {
+		return nil
+	}
+	if v, ok := pactlVolume(string(out)); ok && v > max {
+		return runTool("pactl", "set-sink-volume", "@DEFAULT_SINK@", fmt.Sprintf("%d%%", max))
+	}
+	return nil
+}
+
+var pactlVolumeRe = regexp.MustCompile(`(\d+)%`)
+
+// pactlVolume returns the first channel's volume in a pactl
+// get-sink-volume output, e.g.
+// "Volume: front-left: 32768 /  50% / -18.06 dB,   front-right: ...".
+func pactlVolume(out string) (int, bool) {
+	m := pactlVolumeRe.FindStringSubmatch(out)
+	if m == nil {
+		return 0, false
+	}
+	v, err := strconv.Atoi(m[1])
+	return v, err == nil
+}
+
+// toggleMute mutes or unmutes the default sink.
+func toggleMute() error {
+	if lookTool("wpctl") == nil {
+		return runTool("wpctl", "set-mute", "@DEFAULT_AUDIO_SINK@", "toggle")
+	}
+	if lookTool("pactl") == nil {
+		return runTool("pactl", "set-sink-mute", "@DEFAULT_SINK@", "toggle")
+	}
+	return errNoControl
+}
+
+// changeBrightness changes the backlight by step percent, never turning it
+// off, with brightnessctl or through logind.
+func changeBrightness(step int) error {
+	if lookTool("brightnessctl") == nil {
+		sign := "+"
+		if step < 0 {
+			sign, step = "-", -step
+		}
+		return runTool("brightnessctl", "--quiet", "--min-value=1", "set", fmt.Sprintf("%d%%%s", step, sign))
+	}
+
+	dirs, _ := filepath.Glob(backlightGlob)
+	if len(dirs) == 0 {
+		return errNoControl
+	}
+	dir := dirs[0]
+	cur, err := readInt(filepath.Join(dir, "brightness"))
+	if err != nil {
+		return err
+	}
+	max, err := readInt(filepath.Join(dir, "max_brightness"))
+	if err != nil {
+		return err
+	}
+	v := cur + max*step/100
+	if v < 1 {
+		v = 1
+	}
+	if v > max {
+		v = max
+	}
+	// logind lets the session's user set the backlight without root.
+	call := DBusCall{
+		Bus:    "system",
+		Dest:   "org.freedesktop.login1",
+		Path:   "/org/freedesktop/login1/session/auto",
+		Method: "org.freedesktop.login1.Session.SetBrightness",
+		Args:   []string{"string:backlight", "string:" + filepath.Base(dir), fmt.Sprintf("uint32:%d", v)},
+	}
+	return runTool(call.argv(defaultDBusTimeout)...)
+}
+
+func readInt(path string) (int, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(b)))
+}
+
+// runTool runs a command, its output is part of the error.
+func runTool(argv ...string) error {
+	out, err := toolOutput(toolTimeout, argv...)
+	if err != nil {
+		return fmt.Errorf("%s: %v: %s", argv[0], err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
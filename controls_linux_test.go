@@ -0,0 +1,237 @@
+//go:build linux
+
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeTools stands in for the volume and brightness tools of the host.
+type fakeTools struct {
+	// installed are the tools found on the path.
+	installed map[string]bool
+	// output is the output of a command line, by the command line.
+	output map[string]string
+	// fail makes a command line exit with an error.
+	fail map[string]bool
+	// calls are the command lines run.
+	calls []string
+}
+
+// install replaces the tools until the test ends.
+func (f *fakeTools) install(t *testing.T) {
+	look, out, glob := lookTool, toolOutput, backlightGlob
+	t.Cleanup(func() { lookTool, toolOutput, backlightGlob = look, out, glob })
+
+	lookTool = func(name string) error {
+		if !f.installed[name] {
+			return errors.New("not found")
+		}
+		return nil
+	}
+	toolOutput = func(_ time.Duration, argv ...string) ([]byte, error) {
+		cmd := strings.Join(argv, " ")
+		f.calls = append(f.calls, cmd)
+		if f.fail[cmd] {
+			return []byte(f.output[cmd]), errors.New("exit status 1")
+		}
+		return []byte(f.output[cmd]), nil
+	}
+	backlightGlob = filepath.Join(t.TempDir(), "*")
+}
+
+func (f *fakeTools) expectCalls(t *testing.T, want ...string) {
+	t.Helper()
+	if strings.Join(f.calls, "\n") != strings.Join(want, "\n") {
+		t.Errorf("ran %q, want %q", f.calls, want)
+	}
+	f.calls = nil
+}
+
+// backlight creates a backlight device with the brightness files.
+func backlight(t *testing.T, name, brightness, max string) {
+	t.Helper()
+	dir := filepath.Join(filepath.Dir(backlightGlob), name)
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for file, v := range map[string]string{"brightness": brightness, "max_brightness": max} {
+		if err := os.WriteFile(filepath.Join(dir, file), []byte(v+"\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestPactlVolume(t *testing.T) {
+	tests := []struct {
+		out  string
+		want int
+		ok   bool
+	}{
+		{"Volume: front-left: 32768 /  50% / -18.06 dB,   front-right: 32768 /  50% / -18.06 dB\n", 50, true},
+		{"Volume: front-left: 98304 / 150% / 10.57 dB,   front-right: 65536 / 100% / 0.00 dB\n", 150, true},
+		{"Volume: mono: 0 /   0% / -inf dB\n", 0, true},
+		{"", 0, false},
+		{"Connection failure: Connection refused\n", 0, false},
+	}
+	for _, tt := range tests {
+		v, ok := pactlVolume(tt.out)
+		if v != tt.want || ok != tt.ok {
+			t.Errorf("pactlVolume(%q) = %d, %v, want %d, %v", tt.out, v, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestChangeVolumeWpctl(t *testing.T) {
+	f := &fakeTools{installed: map[string]bool{"wpctl": true, "pactl": true}}
+	f.install(t)
+
+	if err := changeVolume(5, 150); err != nil {
+		t.Fatal(err)
+	}
+	if err := changeVolume(-10, 100); err != nil {
+		t.Fatal(err)
+	}
+	if err := toggleMute(); err != nil {
+		t.Fatal(err)
+	}
+	f.expectCalls(t,
+		"wpctl set-volume -l 1.50 @DEFAULT_AUDIO_SINK@ 5%+",
+		"wpctl set-volume -l 1.00 @DEFAULT_AUDIO_SINK@ 10%-",
+		"wpctl set-mute @DEFAULT_AUDIO_SINK@ toggle")
+}
+
+func TestChangeVolumePactl(t *testing.T) {
+	f := &fakeTools{
+		installed: map[string]bool{"pactl": true},
+		output:    map[string]string{},
+	}
+	f.install(t)
+	get := "pactl get-sink-volume @DEFAULT_SINK@"
+
+	// Below the maximum the volume is left alone.
+	f.output[get] = "Volume: front-left: 62259 /  95% / -1.34 dB\n"
+	if err := changeVolume(5, 100); err != nil {
+		t.Fatal(err)
+	}
+	f.expectCalls(t, "pactl set-sink-volume @DEFAULT_SINK@ +5%", get)
+
+	// Above it, it is set back to the maximum.
+	f.output[get] = "Volume: front-left: 72089 / 110% / 2.48 dB\n"
+	if err := changeVolume(5, 100); err != nil {
+		t.Fatal(err)
+	}
+	f.expectCalls(t, "pactl set-sink-volume @DEFAULT_SINK@ +5%", get,
+		"pactl set-sink-volume @DEFAULT_SINK@ 100%")
+
+	// Turning it down never passes the maximum.
+	if err := changeVolume(-5, 100); err != nil {
+		t.Fatal(err)
+	}
+	f.expectCalls(t, "pactl set-sink-volume @DEFAULT_SINK@ -5%")
+
+	if err := toggleMute(); err != nil {
+		t.Fatal(err)
+	}
+	f.expectCalls(t, "pactl set-sink-mute @DEFAULT_SINK@ toggle")
+}
+
+func TestChangeBrightnessctl(t *testing.T) {
+	f := &fakeTools{installed: map[string]bool{"brightnessctl": true}}
+	f.install(t)
+	backlight(t, "intel_backlight", "50", "100")
+
+	if err := changeBrightness(10); err != nil {
+		t.Fatal(err)
+	}
+	if err := changeBrightness(-10); err != nil {
+		t.Fatal(err)
+	}
+	f.expectCalls(t,
+		"brightnessctl --quiet --min-value=1 set 10%+",
+		"brightnessctl --quiet --min-value=1 set 10%-")
+}
+
+func TestChangeBrightnessLogind(t *testing.T) {
+	tests := []struct {
+		step int
+		want string
+	}{
+		{10, "uint32:918"},
+		{-10, "uint32:612"},
+		// The backlight stays on and doesn't pass its maximum.
+		{-100, "uint32:1"},
+		{100, "uint32:1530"},
+	}
+	for _, tt := range tests {
+		f := &fakeTools{}
+		f.install(t)
+		backlight(t, "intel_backlight", "765", "1530")
+
+		if err := changeBrightness(tt.step); err != nil {
+			t.Fatalf("step %d: %v", tt.step, err)
+		}
+		if len(f.calls) != 1 {
+			t.Fatalf("step %d: ran %q, want one dbus-send", tt.step, f.calls)
+		}
+		call := f.calls[0]
+		if !strings.HasPrefix(call, "dbus-send --system") || !strings.Contains(call, "string:intel_backlight") ||
+			!strings.HasSuffix(call, " "+tt.want) {
+			t.Errorf("step %d: ran %q, want SetBrightness of intel_backlight to %s", tt.step, call, tt.want)
+		}
+	}
+}
+
+func TestChangeBrightnessBadBacklight(t *testing.T) {
+	f := &fakeTools{}
+	f.install(t)
+	backlight(t, "acpi_video0", "bright", "100")
+
+	if err := changeBrightness(10); err == nil {
+		t.Error("changeBrightness succeeded with an unreadable brightness")
+	}
+	f.expectCalls(t)
+}
+
+func TestControlsWithoutTools(t *testing.T) {
+	f := &fakeTools{}
+	f.install(t)
+
+	for name, err := range map[string]error{
+		"changeVolume":     changeVolume(5, 100),
+		"toggleMute":       toggleMute(),
+		"changeBrightness": changeBrightness(10),
+	} {
+		if err != errNoControl {
+			t.Errorf("%s() = %v, want %v", name, err, errNoControl)
+		}
+	}
+	f.expectCalls(t)
+
+	// The builtin sends the media key instead.
+	h, sink := newTestHandler(t, "")
+	runBuiltin(h, "volume-up")
+	waitEvents(t, sink, 2)
+	expectEvents(t, sink, "key XF86AudioRaiseVolume down", "key XF86AudioRaiseVolume up")
+}
+
+func TestControlToolFails(t *testing.T) {
+	set := "pactl set-sink-volume @DEFAULT_SINK@ +5%"
+	f := &fakeTools{
+		installed: map[string]bool{"pactl": true},
+		output:    map[string]string{set: "Connection failure: Connection refused\n"},
+		fail:      map[string]bool{set: true},
+	}
+	f.install(t)
+
+	err := changeVolume(5, 100)
+	if err == nil || !strings.Contains(err.Error(), "pactl") || !strings.Contains(err.Error(), "Connection refused") {
+		t.Errorf("changeVolume() = %v, want the pactl error and its output", err)
+	}
+	f.expectCalls(t, set)
+}
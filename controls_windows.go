@@ -0,0 +1,18 @@
+//go:build windows
+
+package main
+
+// Windows changes the volume and brightness for the media keys itself, the
+// controls always send them.
+
+func changeVolume(step, max int) error {
+	return errNoControl
+}
+
+func toggleMute() error {
+	return errNoControl
+}
+
+func changeBrightness(step int) error {
+	return errNoControl
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/netham45/magic4pc_altclient/m4p"
+)
+
+// deviceFilter selects which advertised TV to use. Empty fields match any TV.
+type deviceFilter struct {
+	model string
+	mac   string
+}
+
+func (f deviceFilter) match(dev m4p.DeviceInfo) bool {
+	if f.model != "" && !strings.EqualFold(f.model, dev.Model) {
+		return false
+	}
+	if f.mac != "" && !strings.EqualFold(f.mac, dev.MAC) {
+		return false
+	}
+	return true
+}
+
+// discoveryHub shares one discovery listener between the TVs, handing each
+// advertised TV to a single tracker.
+type discoveryHub struct {
+	trackers []*deviceTracker
+}
+
+// add returns a tracker for the TV selected by filter. All trackers must be
+// added before run.
+func (hub *discoveryHub) add(filter deviceFilter) *deviceTracker {
+	t := newDeviceTracker(filter)
+	hub.trackers = append(hub.trackers, t)
+	return t
+}
+
+// run consumes advertisements from d until ctx is done.
+func (hub *discoveryHub) run(ctx context.Context, d *m4p.Discoverer) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case dev := <-d.NextDevice():
+			hub.dispatch(dev)
+		}
+	}
+}
+
+// dispatch passes dev to the tracker following it, or else to the first
+// tracker still looking for a matching TV.
+func (hub *discoveryHub) dispatch(dev m4p.DeviceInfo) {
+	for _, t := range hub.trackers {
+		if t.owns(dev) {
+			t.update(dev)
+			return
+		}
+	}
+	for _, t := range hub.trackers {
+		if t.free() && t.filter.match(dev) {
+			t.update(dev)
+			return
+		}
+	}
+}
+
+// deviceTracker follows the address of a TV found through magic4pc_ad
+// broadcasts. The TV keeps advertising while it's on, so a DHCP lease change
+// shows up as an advertisement from a new address.
+type deviceTracker struct {
+	filter deviceFilter
+
+	mu      sync.Mutex
+	dev     m4p.DeviceInfo
+	found   bool
+	changed chan struct{} // Closed when dev changes.
+	// advertised is signalled on every advertisement of the TV.
+	advertised chan struct{}
+}
+
+func newDeviceTracker(filter deviceFilter) *deviceTracker {
+	return &deviceTracker{
+		filter:     filter,
+		changed:    make(chan struct{}),
+		advertised: make(chan struct{}, 1),
+	}
+}
+
+// owns reports whether dev is the TV the tracker follows.
+func (t *deviceTracker) owns(dev m4p.DeviceInfo) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.found && strings.EqualFold(t.dev.MAC, dev.MAC)
+}
+
+// free reports whether the tracker hasn't found its TV yet.
+func (t *deviceTracker) free() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return !t.found
+}
+
+func (t *deviceTracker) update(dev m4p.DeviceInfo) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	select {
+	case t.advertised <- struct{}{}:
+	default:
+	}
+	if t.found && t.dev.IPAddr == dev.IPAddr && t.dev.Port == dev.Port {
+		return
+	}
+	if t.found {
+		log.Printf("discovery: %s (%s) moved from %s:%d to %s:%d", dev.Model, dev.MAC, t.dev.IPAddr, t.dev.Port, dev.IPAddr, dev.Port)
+	} else {
+		log.Printf("discovery: found %s (%s) at %s:%d", dev.Model, dev.MAC, dev.IPAddr, dev.Port)
+	}
+	t.dev = dev
+	t.found = true
+	close(t.changed)
+	t.changed = make(chan struct{})
+}
+
+// wait blocks until a TV has been found and returns it along with a channel
+// that is closed when its address changes.
+func (t *deviceTracker) wait(ctx context.Context) (m4p.DeviceInfo, <-chan struct{}, error) {
+	for {
+		t.mu.Lock()
+		dev, found, changed := t.dev, t.found, t.changed
+		t.mu.Unlock()
+		if found {
+			return dev, changed, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return m4p.DeviceInfo{}, nil, ctx.Err()
+		case <-changed:
+		}
+	}
+}
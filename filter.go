@@ -0,0 +1,221 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// Pointer filter types.
+const (
+	filterOneEuro  = "one-euro"
+	filterEMA      = "ema"
+	filterDeadZone = "deadzone"
+)
+
+// Filter defaults.
+const (
+	defaultMinCutoff = 1.0   // Hz
+	defaultBeta      = 0.007 // Cutoff increase per px/s of speed.
+	defaultDCutoff   = 1.0   // Hz
+	defaultAlpha     = 0.5
+	defaultRadius    = 4.0 // px
+)
+
+// FilterConfig configures one stage of the pointer filter chain. Only the
+// parameters of the selected type are used, zero values take the defaults.
+type FilterConfig struct {
+	// Type is one-euro, ema or deadzone.
+	Type string `json:"type"`
+	// MinCutoff is the One Euro cutoff frequency at rest in Hz, lower
+	// values remove more jitter.
+	MinCutoff float64 `json:"minCutoff,omitempty"`
+	// Beta raises the One Euro cutoff with speed, higher values reduce lag
+	// on fast movements.
+	Beta float64 `json:"beta,omitempty"`
+	// DCutoff is the One Euro cutoff for the speed estimate in Hz.
+	DCutoff float64 `json:"dCutoff,omitempty"`
+	// Alpha is the EMA weight of a new sample, 0 < alpha <= 1.
+	Alpha float64 `json:"alpha,omitempty"`
+	// Radius in TV pixels the pointer must leave before the dead zone lets
+	// it move.
+	Radius float64 `json:"radius,omitempty"`
+}
+
+func (c FilterConfig) validate() error {
+	switch c.Type {
+	case filterOneEuro, filterDeadZone:
+	case filterEMA:
+		if c.Alpha < 0 || c.Alpha > 1 {
+			return fmt.Errorf("ema alpha must be within (0, 1]")
+		}
+	default:
+		return fmt.Errorf("unknown pointer filter %q", c.Type)
+	}
+	if c.MinCutoff < 0 || c.Beta < 0 || c.DCutoff < 0 || c.Radius < 0 {
+		return fmt.Errorf("%s parameters must not be negative", c.Type)
+	}
+	return nil
+}
+
+func orDefault(v, def float64) float64 {
+	if v == 0 {
+		return def
+	}
+	return v
+}
+
+// pointerFilter smooths a stream of pointer positions.
+type pointerFilter interface {
+	filter(t time.Time, x, y float64) (float64, float64)
+}
+
+func newPointerFilter(c FilterConfig) pointerFilter {
+	switch c.Type {
+	case filterOneEuro:
+		return &oneEuroFilter{
+			minCutoff: orDefault(c.MinCutoff, defaultMinCutoff),
+			beta:      orDefault(c.Beta, defaultBeta),
+			dCutoff:   orDefault(c.DCutoff, defaultDCutoff),
+		}
+	case filterEMA:
+		return &emaFilter{alpha: orDefault(c.Alpha, defaultAlpha)}
+	case filterDeadZone:
+		return &deadZoneFilter{radius: orDefault(c.Radius, defaultRadius)}
+	}
+	return nil
+}
+
+// filterChain applies the configured filters in order. It is rebuilt when
+// the configuration changes, e.g. on a profile switch.
+type filterChain struct {
+	config  []FilterConfig
+	filters []pointerFilter
+}
+
+// configure rebuilds the chain if config differs from the current one.
+func (fc *filterChain) configure(config []FilterConfig) {
+	if len(config) == len(fc.config) {
+		same := true
+		for i := range config {
+			if config[i] != fc.config[i] {
+				same = false
+				break
+			}
+		}
+		if same {
+			return
+		}
+	}
+	fc.reset(config)
+}
+
+// reset rebuilds the chain, dropping the filter state.
+func (fc *filterChain) reset(config []FilterConfig) {
+	fc.config = config
+	fc.filters = fc.filters[:0]
+	for _, c := range config {
+		fc.filters = append(fc.filters, newPointerFilter(c))
+	}
+}
+
+func (fc *filterChain) apply(t time.Time, x, y float64) (float64, float64) {
+	for _, f := range fc.filters {
+		x, y = f.filter(t, x, y)
+	}
+	return x, y
+}
+
+// lowPass is a first order low pass filter.
+type lowPass struct {
+	y           float64
+	initialized bool
+}
+
+func (lp *lowPass) apply(x, alpha float64) float64 {
+	if !lp.initialized {
+		lp.y = x
+		lp.initialized = true
+		return x
+	}
+	lp.y += alpha * (x - lp.y)
+	return lp.y
+}
+
+// lowPassAlpha returns the smoothing factor for a cutoff frequency and a
+// sample interval.
+func lowPassAlpha(cutoff, dt float64) float64 {
+	tau := 1 / (2 * math.Pi * cutoff)
+	return 1 / (1 + tau/dt)
+}
+
+// oneEuroFilter is the 1€ filter (Casiez et al.): heavy smoothing while the
+// pointer is slow, little lag when it moves fast.
+type oneEuroFilter struct {
+	minCutoff, beta, dCutoff float64
+
+	last      time.Time
+	prev      [2]float64
+	x, dx     [2]lowPass
+	hasSample bool
+}
+
+func (f *oneEuroFilter) filter(t time.Time, x, y float64) (float64, float64) {
+	in := [2]float64{x, y}
+	if !f.hasSample {
+		f.hasSample = true
+		f.last = t
+		f.prev = in
+		f.x[0].apply(x, 1)
+		f.x[1].apply(y, 1)
+		return x, y
+	}
+
+	dt := t.Sub(f.last).Seconds()
+	if dt <= 0 {
+		return f.x[0].y, f.x[1].y
+	}
+	f.last = t
+
+	var out [2]float64
+	for i := range in {
+		speed := f.dx[i].apply((in[i]-f.prev[i])/dt, lowPassAlpha(f.dCutoff, dt))
+		cutoff := f.minCutoff + f.beta*math.Abs(speed)
+		out[i] = f.x[i].apply(in[i], lowPassAlpha(cutoff, dt))
+	}
+	f.prev = in
+	return out[0], out[1]
+}
+
+// emaFilter is an exponential moving average.
+type emaFilter struct {
+	alpha float64
+	x, y  lowPass
+}
+
+func (f *emaFilter) filter(_ time.Time, x, y float64) (float64, float64) {
+	return f.x.apply(x, f.alpha), f.y.apply(y, f.alpha)
+}
+
+// deadZoneFilter holds the pointer still while the input stays within
+// radius of it, so tremor doesn't move it off a small target. Larger
+// movements drag the pointer along, trailing by radius.
+type deadZoneFilter struct {
+	radius    float64
+	x, y      float64
+	hasSample bool
+}
+
+func (f *deadZoneFilter) filter(_ time.Time, x, y float64) (float64, float64) {
+	if !f.hasSample {
+		f.x, f.y = x, y
+		f.hasSample = true
+		return x, y
+	}
+	if d := math.Hypot(x-f.x, y-f.y); d > f.radius {
+		k := (d - f.radius) / d
+		f.x += (x - f.x) * k
+		f.y += (y - f.y) * k
+	}
+	return f.x, f.y
+}
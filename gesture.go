@@ -0,0 +1,218 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// Gesture defaults.
+const (
+	defaultLongPress      = 500 * time.Millisecond
+	defaultDoubleTap      = 300 * time.Millisecond
+	defaultRepeatDelay    = 400 * time.Millisecond
+	defaultRepeatInterval = 80 * time.Millisecond
+	defaultCombo          = 150 * time.Millisecond
+)
+
+// GestureConfig holds the timing of long-press, double-tap, repeat and
+// combos. Unset fields take the defaults.
+type GestureConfig struct {
+	// LongPress is how long a key must be held to trigger its longPress
+	// action.
+	LongPress duration `json:"longPress,omitempty"`
+	// DoubleTap is the longest pause between two taps of a double tap.
+	DoubleTap duration `json:"doubleTap,omitempty"`
+	// RepeatDelay is how long a repeating key is held before it repeats,
+	// RepeatInterval the time between repeats.
+	RepeatDelay    duration `json:"repeatDelay,omitempty"`
+	RepeatInterval duration `json:"repeatInterval,omitempty"`
+	// Combo is the longest time between the presses of a combo's keys.
+	Combo duration `json:"combo,omitempty"`
+}
+
+func (c GestureConfig) merge(o GestureConfig) GestureConfig {
+	if o.LongPress != 0 {
+		c.LongPress = o.LongPress
+	}
+	if o.DoubleTap != 0 {
+		c.DoubleTap = o.DoubleTap
+	}
+	if o.RepeatDelay != 0 {
+		c.RepeatDelay = o.RepeatDelay
+	}
+	if o.RepeatInterval != 0 {
+		c.RepeatInterval = o.RepeatInterval
+	}
+	if o.Combo != 0 {
+		c.Combo = o.Combo
+	}
+	return c
+}
+
+func (c GestureConfig) validate() error {
+	if c.LongPress < 0 || c.DoubleTap < 0 || c.RepeatDelay < 0 || c.RepeatInterval < 0 || c.Combo < 0 {
+		return fmt.Errorf("gesture times must not be negative")
+	}
+	return nil
+}
+
+func (c GestureConfig) longPress() time.Duration {
+	return durationOr(c.LongPress, defaultLongPress)
+}
+
+func (c GestureConfig) doubleTap() time.Duration {
+	return durationOr(c.DoubleTap, defaultDoubleTap)
+}
+
+func (c GestureConfig) repeatDelay() time.Duration {
+	return durationOr(c.RepeatDelay, defaultRepeatDelay)
+}
+
+func (c GestureConfig) repeatInterval() time.Duration {
+	return durationOr(c.RepeatInterval, defaultRepeatInterval)
+}
+
+func (c GestureConfig) combo() time.Duration {
+	return durationOr(c.Combo, defaultCombo)
+}
+
+func durationOr(d duration, def time.Duration) time.Duration {
+	if d == 0 {
+		return def
+	}
+	return time.Duration(d)
+}
+
+// keyPhase is where a remote key is in recognising a gesture.
+type keyPhase int
+
+const (
+	// keyIdle is released, with no gesture pending.
+	keyIdle keyPhase = iota
+	// keyHolding holds the active action until the key is released.
+	keyHolding
+	// keyRepeating taps the action until the key is released.
+	keyRepeating
+	// keyPressed waits for the long-press threshold or the release.
+	keyPressed
+	// keyReleased waits for the second tap of a double tap.
+	keyReleased
+)
+
+// keyState tracks the gesture of one remote key.
+type keyState struct {
+	phase  keyPhase
+	action Action // The binding when the gesture started.
+	active Action // Held down in keyHolding.
+	env    actionEnv
+	timer  *time.Timer
+	// gen invalidates timers that fire after the state moved on.
+	gen int
+}
+
+// stop cancels the pending timer.
+func (k *keyState) stop() {
+	k.gen++
+	if k.timer != nil {
+		k.timer.Stop()
+		k.timer = nil
+	}
+}
+
+// gesture runs the gestures of a remote key press or release, with h.mu
+// held.
+func (h *handler) gesture(code int, pressed bool) {
+	k := h.keys[code]
+	if k == nil {
+		k = &keyState{}
+		h.keys[code] = k
+	}
+	g := h.mapping.Gestures
+
+	if !pressed {
+		switch k.phase {
+		case keyHolding:
+			h.run(k.active, false, k.env)
+			k.phase = keyIdle
+		case keyRepeating:
+			k.stop()
+			k.phase = keyIdle
+		case keyPressed:
+			// A short press: the action itself, unless a second tap follows.
+			k.stop()
+			if k.action.DoubleTap == nil {
+				h.tap(k.action, k.env)
+				k.phase = keyIdle
+				return
+			}
+			k.phase = keyReleased
+			h.after(k, g.doubleTap(), func() {
+				h.tap(k.action, k.env)
+				k.phase = keyIdle
+			})
+		}
+		return
+	}
+
+	if k.phase == keyReleased {
+		k.stop()
+		h.hold(k, *k.action.DoubleTap)
+		return
+	}
+	if k.phase != keyIdle {
+		// A repeated down event while held.
+		return
+	}
+
+	h.profiles.poke()
+	a, ok := h.action(code)
+	if !ok || h.locked && a.Builtin != "lock-input" {
+		return
+	}
+	k.action = a
+	k.env = h.env(code)
+	switch {
+	case a.Repeat:
+		h.tap(a, k.env)
+		k.phase = keyRepeating
+		h.repeat(k, g.repeatDelay(), g.repeatInterval())
+	case a.LongPress != nil:
+		k.phase = keyPressed
+		h.after(k, g.longPress(), func() {
+			h.hold(k, *k.action.LongPress)
+		})
+	case a.DoubleTap != nil:
+		k.phase = keyPressed
+	default:
+		h.hold(k, a)
+	}
+}
+
+// hold presses a until the key of k is released.
+func (h *handler) hold(k *keyState, a Action) {
+	k.active = a
+	k.phase = keyHolding
+	h.run(a, true, k.env)
+}
+
+// after calls f with the handler locked after d, unless k moved on.
+func (h *handler) after(k *keyState, d time.Duration, f func()) {
+	k.stop()
+	gen := k.gen
+	k.timer = time.AfterFunc(d, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if k.gen == gen {
+			k.timer = nil
+			f()
+		}
+	})
+}
+
+// repeat taps the action of k every interval after delay.
+func (h *handler) repeat(k *keyState, delay, interval time.Duration) {
+	h.after(k, delay, func() {
+		h.tap(k.action, k.env)
+		h.repeat(k, interval, interval)
+	})
+}
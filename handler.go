@@ -0,0 +1,177 @@
+package main
+
+import (
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/netham45/magic4pc_altclient/m4p"
+)
+
+// handler turns messages from the TV into input events.
+type handler struct {
+	sink     InputSink
+	mapping  *Mapping
+	profiles *profileSelector
+	screen   *screenMapper
+
+	// mu guards the key gestures and the state the builtins change, the
+	// gesture timers run on other goroutines.
+	mu sync.Mutex
+	// keys by keycode, they keep the action they were pressed with so a
+	// profile switch in between still releases what was pressed.
+	keys   map[int]*keyState
+	combos comboState
+	// held are the keys that went down outside of text entry, they are
+	// handled as usual until released.
+	held map[int]bool
+	// pointerMode overrides the configured pointer mode when set.
+	pointerMode string
+	// locked ignores the remote, except to unlock it.
+	locked bool
+	text   textEntry
+	// scrollHorizontal turns the wheel sideways while set.
+	scrollHorizontal bool
+	// wheelNotch is the smallest wheel delta seen, taken as one notch.
+	wheelNotch int
+	// scrollX/Y are the scroll fractions not yet sent.
+	scrollX, scrollY float64
+	// dragLocked holds the left button down. pressedAt is when the wheel
+	// button went down, swallowUp drops its release after a tap that ended
+	// a drag.
+	dragLocked bool
+	pressedAt  time.Time
+	swallowUp  bool
+
+	// The pointer state below isn't guarded by mu, only handle, on the
+	// goroutine receiving from the TV, uses it.
+	air     airMouse
+	filters filterChain
+	// filterMode is the pointer mode the filters last ran in.
+	filterMode string
+	// Relative modes filter a virtual position, virtX/Y, and emit the
+	// whole pixels the filtered position moved beyond emittedX/Y.
+	virtX, virtY       float64
+	emittedX, emittedY float64
+	// history holds the recent pointer positions and freezeUntil stops
+	// pointer motion, for clickFreeze.
+	history     []pointerSample
+	freezeUntil time.Time
+}
+
+func newHandler(sink InputSink, mapping *Mapping, profiles *profileSelector, screen *screenMapper) *handler {
+	return &handler{
+		sink:     sink,
+		mapping:  mapping,
+		profiles: profiles,
+		screen:   screen,
+		keys:     make(map[int]*keyState),
+		held:     make(map[int]bool),
+		combos:   comboState{suppressed: make(map[int]bool)},
+	}
+}
+
+func (h *handler) handle(m m4p.Message) {
+	switch m.Type {
+	case m4p.InputMessage:
+		key := m.Input.Parameters.KeyCode
+		pressed := m.Input.Parameters.IsDown
+		debugf("Key: %d pressed: %v", key, pressed)
+		h.key(key, pressed)
+
+	case m4p.RemoteUpdateMessage:
+		f, err := m.RemoteUpdate.Frame()
+		if err != nil {
+			log.Printf("handle: %s decode failed: %v", m.Type, err)
+			return
+		}
+		h.pointer(f)
+
+	case m4p.MouseMessage:
+		switch m.Mouse.Type {
+		case "mousedown":
+			h.button(true)
+		case "mouseup":
+			h.button(false)
+		}
+
+	case m4p.WheelMessage:
+		h.wheel(int(m.Wheel.Delta))
+
+	default:
+	}
+}
+
+func (h *handler) isLocked() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.locked
+}
+
+// pointerConfig returns the pointer settings in effect.
+func (h *handler) pointerConfig() PointerConfig {
+	c := h.mapping.pointer(h.profiles.profile())
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.pointerMode != "" {
+		c.Mode = h.pointerMode
+	}
+	return c
+}
+
+func (h *handler) pointer(f m4p.SensorFrame) {
+	c := h.pointerConfig()
+	if c.disabled() || h.isLocked() {
+		return
+	}
+
+	now := time.Now()
+	h.configureFilters(c)
+
+	if c.mode() != pointerAbsolute {
+		dx, dy := h.air.motion(f, c, now)
+		if h.frozen(now) {
+			return
+		}
+		h.virtX += dx
+		h.virtY += dy
+		fx, fy := h.filters.apply(now, h.virtX, h.virtY)
+		mx := math.Trunc(fx - h.emittedX)
+		my := math.Trunc(fy - h.emittedY)
+		if mx != 0 || my != 0 {
+			h.emittedX += mx
+			h.emittedY += my
+			h.sink.MoveRelative(int(mx), int(my))
+		}
+		h.record(c, now, h.emittedX, h.emittedY)
+		return
+	}
+
+	if !f.Has(m4p.FilterCoordinate) {
+		return
+	}
+	if (f.Coordinate.X != 0 || f.Coordinate.Y != 0) && !h.frozen(now) {
+		x, y := h.filters.apply(now, float64(f.Coordinate.X), float64(f.Coordinate.Y))
+		dx, dy := h.screen.toDesktop(int(math.Round(x)), int(math.Round(y)))
+		h.sink.Move(dx, dy)
+		h.record(c, now, float64(dx), float64(dy))
+	}
+}
+
+// configureFilters sets up the filters for c. They start over when the
+// pointer mode changes, absolute positions and the virtual position of the
+// relative modes don't mix.
+func (h *handler) configureFilters(c PointerConfig) {
+	mode := c.mode()
+	if mode == h.filterMode {
+		h.filters.configure(c.Filters)
+		return
+	}
+	h.filterMode = mode
+	h.filters.reset(c.Filters)
+	h.air = airMouse{}
+	h.virtX, h.virtY = 0, 0
+	h.emittedX, h.emittedY = 0, 0
+	h.history = h.history[:0]
+}
@@ -0,0 +1,448 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/netham45/magic4pc_altclient/m4p"
+)
+
+// newTestHandler returns a handler recording its input, with the default
+// mapping minus its profiles and mappingJSON applied on top.
+func newTestHandler(t *testing.T, mappingJSON string) (*handler, *recordSink) {
+	t.Helper()
+	m := defaultMapping()
+	m.Profiles = nil
+	if err := m.resolve(); err != nil {
+		t.Fatal(err)
+	}
+	if mappingJSON != "" {
+		var file Mapping
+		if err := json.Unmarshal([]byte(mappingJSON), &file); err != nil {
+			t.Fatal(err)
+		}
+		if err := file.resolve(); err != nil {
+			t.Fatal(err)
+		}
+		m.merge(&file)
+	}
+	sink := &recordSink{}
+	screen := newScreenMapper(OutputConfig{Name: "1920x1080+0+0"})
+	return newHandler(sink, m, newProfileSelector(m), screen), sink
+}
+
+// setSession switches the profiles of h to those matching session.
+func setSession(h *handler, session string) {
+	h.profiles.probe = func(bool) hostState { return hostState{session: session} }
+	h.profiles.update()
+}
+
+// sensorFrame returns f with every filter present, as decoded from the TV.
+func sensorFrame(f m4p.SensorFrame) m4p.SensorFrame {
+	l, err := m4p.NewLayout(m4p.DefaultFilters)
+	if err != nil {
+		panic(err)
+	}
+	f, err = l.Decode(l.Encode(f))
+	if err != nil {
+		panic(err)
+	}
+	return f
+}
+
+func coordinateFrame(x, y int32) m4p.SensorFrame {
+	return sensorFrame(m4p.SensorFrame{Coordinate: m4p.Coordinates{X: x, Y: y}})
+}
+
+func gyroFrame(yawRate float32) m4p.SensorFrame {
+	return sensorFrame(m4p.SensorFrame{Gyroscope: m4p.Gyroscope{Z: yawRate}})
+}
+
+// runBuiltin runs a handler builtin as a mapped key would.
+func runBuiltin(h *handler, name string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.run(Action{Builtin: name}, true, h.env())
+}
+
+func expectEvents(t *testing.T, sink *recordSink, want ...string) {
+	t.Helper()
+	got := sink.Events()
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got events %q, want %q", got, want)
+	}
+}
+
+func TestPointerModeSwitchResetsFilters(t *testing.T) {
+	h, sink := newTestHandler(t, `{
+		"pointer": {"filters": [{"type": "ema", "alpha": 0.5}]},
+		"profiles": [{"name": "air", "match": {"session": "air"}, "pointer": {"mode": "gyro"}}]
+	}`)
+
+	setSession(h, "x11")
+	for i := 0; i < 5; i++ {
+		h.pointer(coordinateFrame(1500, 900))
+	}
+	sink.Events()
+
+	setSession(h, "air")
+	for i := 0; i < 10; i++ {
+		h.pointer(gyroFrame(-0.5))
+		time.Sleep(5 * time.Millisecond)
+	}
+	events := sink.Events()
+	if len(events) == 0 {
+		t.Fatal("no relative motion in gyro mode")
+	}
+	for _, ev := range events {
+		var dx, dy int
+		if _, err := fmt.Sscanf(ev, "moverel %d %d", &dx, &dy); err != nil {
+			t.Fatalf("unexpected event %q", ev)
+		}
+		if abs(dx) > 20 || dy != 0 {
+			t.Errorf("pointer jumped by %d, %d after switching to gyro mode", dx, dy)
+		}
+	}
+
+	// Back in absolute mode the first position isn't smoothed with the
+	// relative ones.
+	setSession(h, "x11")
+	h.pointer(coordinateFrame(960, 540))
+	expectEvents(t, sink, "move 960 540")
+}
+
+func TestPointerModeSwitchResetsClickFreeze(t *testing.T) {
+	h, sink := newTestHandler(t, `{
+		"pointer": {"clickFreeze": "1s", "dragLock": "0s"},
+		"profiles": [{"name": "air", "match": {"session": "air"}, "pointer": {"mode": "gyro"}}]
+	}`)
+
+	// A desktop position close enough to the relative origin to rewind to.
+	setSession(h, "x11")
+	h.pointer(coordinateFrame(10, 10))
+	setSession(h, "air")
+	h.pointer(gyroFrame(0))
+	sink.Events()
+
+	// The click doesn't move the pointer back to the desktop position.
+	h.button(true)
+	expectEvents(t, sink, "click left down")
+}
+
+// waitEvents waits up to a second for timers to record n events.
+func waitEvents(t *testing.T, sink *recordSink, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		sink.mu.Lock()
+		got := len(sink.events)
+		sink.mu.Unlock()
+		if got >= n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d events, want %d", got, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestGestures(t *testing.T) {
+	h, sink := newTestHandler(t, `{
+		"keys": {
+			"red": {"key": "a", "longPress": {"key": "b"}},
+			"green": {"key": "x", "doubleTap": {"key": "y"}},
+			"up": {"key": "Up", "repeat": true}
+		},
+		"gestures": {"longPress": "100ms", "doubleTap": "100ms", "repeatDelay": "30ms", "repeatInterval": "10ms"}
+	}`)
+
+	// A short press taps the key on release, a long one holds the
+	// longPress action until released.
+	h.key(m4p.KeyRed, true)
+	h.key(m4p.KeyRed, false)
+	expectEvents(t, sink, "key a down", "key a up")
+	h.key(m4p.KeyRed, true)
+	waitEvents(t, sink, 1)
+	h.key(m4p.KeyRed, false)
+	expectEvents(t, sink, "key b down", "key b up")
+
+	// A single tap waits for the double tap time, a second tap holds the
+	// doubleTap action.
+	h.key(m4p.KeyGreen, true)
+	h.key(m4p.KeyGreen, false)
+	expectEvents(t, sink)
+	waitEvents(t, sink, 2)
+	expectEvents(t, sink, "key x down", "key x up")
+	h.key(m4p.KeyGreen, true)
+	h.key(m4p.KeyGreen, false)
+	h.key(m4p.KeyGreen, true)
+	h.key(m4p.KeyGreen, false)
+	expectEvents(t, sink, "key y down", "key y up")
+
+	// A repeating key taps at once, then after the delay until released.
+	h.key(m4p.KeyUp, true)
+	waitEvents(t, sink, 6)
+	h.key(m4p.KeyUp, false)
+	events := sink.Events()
+	for i, ev := range events {
+		if want := []string{"key Up down", "key Up up"}[i%2]; ev != want {
+			t.Fatalf("repeat event %d = %q, want %q", i, ev, want)
+		}
+	}
+	time.Sleep(50 * time.Millisecond)
+	expectEvents(t, sink)
+}
+
+func TestKeys(t *testing.T) {
+	h, sink := newTestHandler(t, `{"keys": {"red": {"chord": ["ctrl", "c"]}}}`)
+
+	h.key(m4p.KeyLeft, true)
+	h.key(m4p.KeyLeft, true) // Repeated while held.
+	h.key(m4p.KeyLeft, false)
+	expectEvents(t, sink, "key Left down", "key Left up")
+
+	h.key(m4p.KeyBlue, true)
+	h.key(m4p.KeyBlue, false)
+	expectEvents(t, sink, "click right down", "click right up")
+
+	h.key(m4p.KeyRed, true)
+	h.key(m4p.KeyRed, false)
+	expectEvents(t, sink, "key ctrl down", "key c down", "key c up", "key ctrl up")
+
+	// Keys without an action do nothing.
+	h.key(m4p.KeyYellow, true)
+	h.key(m4p.KeyYellow, false)
+	expectEvents(t, sink)
+
+	// A key pressed before the input is locked is still released.
+	h.key(m4p.KeyLeft, true)
+	runBuiltin(h, "lock-input")
+	h.key(m4p.KeyLeft, false)
+	h.key(m4p.KeyUp, true)
+	h.key(m4p.KeyUp, false)
+	expectEvents(t, sink, "key Left down", "key Left up")
+}
+
+func TestCombos(t *testing.T) {
+	h, sink := newTestHandler(t, `{
+		"keys": {"red": {"key": "r"}, "green": {"key": "g"}},
+		"combos": [{"keys": ["red", "green"], "key": "F5"}],
+		"gestures": {"combo": "100ms"}
+	}`)
+
+	// Both keys together run the combo instead of their own actions, until
+	// one of them is released.
+	h.key(m4p.KeyRed, true)
+	h.key(m4p.KeyGreen, true)
+	h.key(m4p.KeyRed, false)
+	h.key(m4p.KeyGreen, false)
+	expectEvents(t, sink, "key F5 down", "key F5 up")
+
+	// A combo key alone is passed on after the combo time, or when it is
+	// released before.
+	h.key(m4p.KeyRed, true)
+	expectEvents(t, sink)
+	waitEvents(t, sink, 1)
+	h.key(m4p.KeyRed, false)
+	expectEvents(t, sink, "key r down", "key r up")
+	h.key(m4p.KeyGreen, true)
+	h.key(m4p.KeyGreen, false)
+	expectEvents(t, sink, "key g down", "key g up")
+
+	// Keys that aren't in the combo pass the pending one on.
+	h.key(m4p.KeyRed, true)
+	h.key(m4p.KeyLeft, true)
+	h.key(m4p.KeyLeft, false)
+	h.key(m4p.KeyRed, false)
+	expectEvents(t, sink, "key r down", "key Left down", "key Left up", "key r up")
+}
+
+func TestWheel(t *testing.T) {
+	h, sink := newTestHandler(t, `{
+		"keys": {"yellow": {"builtin": "scroll-horizontal"}},
+		"pointer": {"scroll": {"notchDelta": 120, "linesPerNotch": 0.5, "hiRes": false}}
+	}`)
+
+	// Half a line per notch, the rest is kept for the next notch.
+	h.wheel(120)
+	expectEvents(t, sink)
+	h.wheel(120)
+	expectEvents(t, sink, "scroll 0 1")
+	h.wheel(240)
+	expectEvents(t, sink, "scroll 0 1")
+
+	// Turning back drops what is left of the other direction.
+	h.wheel(120)
+	h.wheel(-120)
+	expectEvents(t, sink)
+	h.wheel(-120)
+	expectEvents(t, sink, "scroll 0 -1")
+
+	// Up scrolls left while scroll-horizontal is held.
+	h.key(m4p.KeyYellow, true)
+	h.wheel(240)
+	h.key(m4p.KeyYellow, false)
+	h.wheel(240)
+	expectEvents(t, sink, "scroll -1 0", "scroll 0 1")
+}
+
+func TestWheelNatural(t *testing.T) {
+	h, sink := newTestHandler(t, `{"pointer": {"scroll": {"natural": true, "hiRes": false}}}`)
+
+	// The notch is the smallest delta seen.
+	h.wheel(240)
+	expectEvents(t, sink, "scroll 0 -1")
+	h.wheel(120)
+	h.wheel(240)
+	expectEvents(t, sink, "scroll 0 -1", "scroll 0 -2")
+}
+
+func TestDragLock(t *testing.T) {
+	h, sink := newTestHandler(t, `{"pointer": {"dragLock": "50ms", "clickFreeze": "0s"}}`)
+
+	// A tap grabs, the next one lets go.
+	h.button(true)
+	h.button(false)
+	expectEvents(t, sink, "click left down")
+	h.button(true)
+	h.button(false)
+	expectEvents(t, sink, "click left up")
+
+	// Holding the wheel button drags as usual.
+	h.button(true)
+	time.Sleep(60 * time.Millisecond)
+	h.button(false)
+	expectEvents(t, sink, "click left down", "click left up")
+
+	// The drag-lock builtin lets go of a tap grab too.
+	h.button(true)
+	h.button(false)
+	runBuiltin(h, "drag-lock")
+	expectEvents(t, sink, "click left down", "click left up")
+}
+
+func TestASCIIKeys(t *testing.T) {
+	h, sink := newTestHandler(t, `{"ascii": true}`)
+
+	// Letter keys arrive as upper case key codes and type lower case.
+	h.key('A', true)
+	h.key('A', false)
+	expectEvents(t, sink, "key a down", "key a up")
+
+	h.key('@', true)
+	h.key('@', false)
+	expectEvents(t, sink, "key shift down", "key 2 down", "key 2 up", "key shift up")
+}
+
+func TestTextEntryReleasesHeldKeys(t *testing.T) {
+	h, sink := newTestHandler(t, "")
+
+	// A number key held when text entry starts is still let go.
+	h.key(m4p.Key2, true)
+	runBuiltin(h, "text-entry")
+	h.key(m4p.Key2, true)
+	h.key(m4p.Key2, false)
+	expectEvents(t, sink, "key 2 down", "key 2 up")
+
+	h.key(m4p.Key2, true)
+	h.key(m4p.Key2, false)
+	expectEvents(t, sink, `type "a"`)
+}
+
+func TestMultiTap(t *testing.T) {
+	h, sink := newTestHandler(t, `{"textEntry": {"multiTap": "100ms"}}`)
+	tap := func(code int) {
+		h.key(code, true)
+		h.key(code, false)
+	}
+
+	runBuiltin(h, "text-entry")
+	tap(m4p.Key2)
+	tap(m4p.Key2)
+	tap(m4p.Key3)
+	expectEvents(t, sink, `type "a"`, "key BackSpace down", "key BackSpace up", `type "b"`, `type "d"`)
+
+	// After the multi-tap time the key starts over.
+	time.Sleep(120 * time.Millisecond)
+	tap(m4p.Key3)
+	expectEvents(t, sink, `type "d"`)
+
+	// The letters wrap around and text-shift, on red, types upper case.
+	tap(m4p.KeyRed)
+	for i := 0; i < 3; i++ {
+		tap(m4p.Key0)
+	}
+	events := sink.Events()
+	if got := events[len(events)-1]; got != `type " "` {
+		t.Errorf("third tap of 0 typed %s, want a space", got)
+	}
+	tap(m4p.Key2)
+	expectEvents(t, sink, `type "A"`)
+
+	// Back deletes in text entry, outside of it the mapping is back and 2
+	// is an ASCII key.
+	tap(m4p.KeyBack)
+	runBuiltin(h, "text-entry")
+	tap(m4p.KeyBack)
+	tap(m4p.Key2)
+	expectEvents(t, sink, "key BackSpace down", "key BackSpace up", "key 2 down", "key 2 up")
+}
+
+func TestKeyForRune(t *testing.T) {
+	for _, tt := range []struct {
+		r     rune
+		key   string
+		shift bool
+	}{
+		{'a', "a", false},
+		{'A', "a", true},
+		{'1', "1", false},
+		{'@', "2", true},
+		{'?', "/", true},
+		{'/', "/", false},
+		{' ', "space", false},
+		{'\n', "Return", false},
+		{'é', "", false},
+	} {
+		key, shift := keyForRune(tt.r)
+		if key != tt.key || shift != tt.shift {
+			t.Errorf("keyForRune(%q) = %q, %v, want %q, %v", tt.r, key, shift, tt.key, tt.shift)
+		}
+	}
+
+	sink := &recordSink{}
+	typeKeys(sink, "Hi!\n")
+	expectEvents(t, sink,
+		"key shift down", "key h down", "key h up", "key shift up",
+		"key i down", "key i up",
+		"key shift down", "key 1 down", "key 1 up", "key shift up",
+		"key Return down", "key Return up")
+}
+
+func TestTypeKeysComposeProbe(t *testing.T) {
+	probes := 0
+	defer func(f func() bool) { canCompose = f }(canCompose)
+	canCompose = func() bool {
+		probes++
+		return true
+	}
+
+	// ASCII text doesn't probe the host, the others only once.
+	sink := &recordSink{}
+	typeKeys(sink, "abc")
+	typeKeys(sink, "ünïcödé")
+	if probes != 1 {
+		t.Errorf("probed the host %d times, want once", probes)
+	}
+	events := sink.Events()
+	if want := []string{"key ctrl down", "key shift down", "key u down"}; fmt.Sprint(events[6:9]) != fmt.Sprint(want) {
+		t.Errorf("composing ü started with %q, want %q", events[6:9], want)
+	}
+
+	canCompose = func() bool { return false }
+	typeKeys(sink, "é")
+	expectEvents(t, sink)
+}
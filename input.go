@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// InputSink injects input events into the host. Implementations must be
+// safe for use from multiple goroutines.
+type InputSink interface {
+	// Move the pointer to x, y in desktop pixels.
+	Move(x, y int)
+	// MoveRelative moves the pointer by dx, dy screen pixels.
+	MoveRelative(dx, dy int)
+	// Key presses or releases a key by its X keysym name, e.g. "Left",
+	// "Return" or "XF86AudioPlay".
+	Key(key string, down bool)
+	// Type types UTF-8 text, independent of the keys held.
+	Type(text string)
+	// Click presses or releases a mouse button: left, right, middle, x1 or x2.
+	Click(button string, down bool)
+	// Scroll the wheel by dx, dy notches, right and up for positive values.
+	Scroll(dx, dy int)
+	// Close releases the backend.
+	Close() error
+}
+
+// hiResNotch is one notch in high-resolution wheel units.
+const hiResNotch = 120
+
+// hiResScroller is implemented by backends that scroll by fractions of a
+// notch.
+type hiResScroller interface {
+	// ScrollHiRes scrolls by dx, dy in 1/120 of a notch, right and up for
+	// positive values.
+	ScrollHiRes(dx, dy int)
+}
+
+// motionAccumulator sums relative moves until a backend worker picks them
+// up, so slow backends coalesce motion without losing any of it.
+type motionAccumulator struct {
+	mu     sync.Mutex
+	dx, dy int
+	ready  chan struct{}
+}
+
+func newMotionAccumulator() *motionAccumulator {
+	return &motionAccumulator{ready: make(chan struct{}, 1)}
+}
+
+func (a *motionAccumulator) add(dx, dy int) {
+	a.mu.Lock()
+	a.dx += dx
+	a.dy += dy
+	a.mu.Unlock()
+	select {
+	case a.ready <- struct{}{}:
+	default:
+	}
+}
+
+// take returns and resets the accumulated motion.
+func (a *motionAccumulator) take() (dx, dy int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	dx, dy = a.dx, a.dy
+	a.dx, a.dy = 0, 0
+	return dx, dy
+}
+
+// sinkOptions configures the input backends. Each backend uses the fields
+// relevant to it.
+type sinkOptions struct {
+	// uinputPath is the uinput device node, or a regular file to record the
+	// raw events to.
+	uinputPath string
+}
+
+// sinkFactories holds the input backends available on this platform.
+var sinkFactories = map[string]func(sinkOptions) (InputSink, error){}
+
+// registerSink makes an input backend selectable by name.
+func registerSink(name string, factory func(sinkOptions) (InputSink, error)) {
+	if _, ok := sinkFactories[name]; ok {
+		panic("input backend registered twice: " + name)
+	}
+	sinkFactories[name] = factory
+}
+
+// sinkNames returns the registered input backends, sorted.
+func sinkNames() []string {
+	names := make([]string, 0, len(sinkFactories))
+	for name := range sinkFactories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// newSink creates the input backend registered as name.
+func newSink(name string, opts sinkOptions) (InputSink, error) {
+	factory, ok := sinkFactories[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown input backend %q, available: %s", name, strings.Join(sinkNames(), ", "))
+	}
+	return factory(opts)
+}
+
+// sinkPool opens input backends on first use and keeps them open, so
+// macros can run through a backend other than the active one.
+type sinkPool struct {
+	opts sinkOptions
+
+	mu   sync.Mutex
+	open map[string]InputSink
+}
+
+// sinks are the input backends in use.
+var sinks = &sinkPool{open: make(map[string]InputSink)}
+
+// get returns the backend registered as name, creating it if needed.
+func (p *sinkPool) get(name string) (InputSink, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if s, ok := p.open[name]; ok {
+		return s, nil
+	}
+	s, err := newSink(name, p.opts)
+	if err != nil {
+		return nil, err
+	}
+	p.open[name] = s
+	return s, nil
+}
+
+// close closes all open backends.
+func (p *sinkPool) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for name, s := range p.open {
+		s.Close()
+		delete(p.open, name)
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+)
+
+func init() {
+	registerSink("record", func(sinkOptions) (InputSink, error) { return &recordSink{log: true}, nil })
+	registerSink("noop", func(sinkOptions) (InputSink, error) { return &recordSink{}, nil })
+}
+
+// maxRecordedEvents bounds the memory used by a long running recordSink.
+const maxRecordedEvents = 1024
+
+// recordSink keeps every event instead of injecting it. The "record"
+// backend also logs them, "noop" is silent.
+type recordSink struct {
+	log bool
+
+	mu     sync.Mutex
+	events []string
+}
+
+func (s *recordSink) record(format string, args ...interface{}) {
+	ev := fmt.Sprintf(format, args...)
+	if s.log {
+		log.Printf("input: %s", ev)
+	}
+	s.mu.Lock()
+	if len(s.events) == maxRecordedEvents {
+		s.events = s.events[1:]
+	}
+	s.events = append(s.events, ev)
+	s.mu.Unlock()
+}
+
+// Events returns the recorded events, oldest first, and clears them.
+func (s *recordSink) Events() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ev := s.events
+	s.events = nil
+	return ev
+}
+
+func (s *recordSink) Move(x, y int)               { s.record("move %d %d", x, y) }
+func (s *recordSink) MoveRelative(dx, dy int)     { s.record("moverel %d %d", dx, dy) }
+func (s *recordSink) Key(key string, down bool)   { s.record("key %s %s", key, upDown(down)) }
+func (s *recordSink) Type(text string)            { s.record("type %q", text) }
+func (s *recordSink) Click(btn string, down bool) { s.record("click %s %s", btn, upDown(down)) }
+func (s *recordSink) Scroll(dx, dy int)           { s.record("scroll %d %d", dx, dy) }
+func (s *recordSink) Close() error                { return nil }
+
+func upDown(down bool) string {
+	if down {
+		return "down"
+	}
+	return "up"
+}
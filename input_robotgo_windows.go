@@ -0,0 +1,86 @@
+//go:build windows
+
+package main
+
+import (
+	"log"
+
+	"github.com/go-vgo/robotgo"
+)
+
+func init() {
+	registerSink("robotgo", func(sinkOptions) (InputSink, error) { return robotgoSink{}, nil })
+}
+
+// robotgoSink injects input with robotgo, it needs no daemon.
+type robotgoSink struct{}
+
+// Move moves the mouse to x, y on the virtual desktop.
+func (robotgoSink) Move(x, y int) {
+	robotgo.Move(x, y)
+}
+
+// MoveRelative moves the mouse by dx, dy pixels.
+func (robotgoSink) MoveRelative(dx, dy int) {
+	robotgo.MoveRelative(dx, dy)
+}
+
+// robotgoKeys are the robotgo names of X keysyms robotgo doesn't know.
+var robotgoKeys = map[string]string{
+	"XF86AudioPlay":         "audio_play",
+	"XF86AudioPause":        "audio_pause",
+	"XF86AudioStop":         "audio_stop",
+	"XF86AudioNext":         "audio_next",
+	"XF86AudioPrev":         "audio_prev",
+	"XF86AudioMute":         "audio_mute",
+	"XF86AudioRaiseVolume":  "audio_vol_up",
+	"XF86AudioLowerVolume":  "audio_vol_down",
+	"XF86MonBrightnessUp":   "lights_mon_up",
+	"XF86MonBrightnessDown": "lights_mon_down",
+}
+
+// Key sends a key down or up event via robotgo.
+func (robotgoSink) Key(key string, down bool) {
+	state := "up"
+	if down {
+		state = "down"
+	}
+	if k, ok := robotgoKeys[key]; ok {
+		key = k
+	}
+	if err := robotgo.Toggle(key, state); err != nil {
+		log.Printf("inputKey %s %s: %v", key, state, err)
+	}
+}
+
+// Type types text with robotgo, which sends it as Unicode characters.
+func (robotgoSink) Type(text string) {
+	robotgo.TypeStr(text)
+}
+
+// Click sends a mouse button down or up event via robotgo.
+func (robotgoSink) Click(button string, down bool) {
+	state := "up"
+	if down {
+		state = "down"
+	}
+	switch button {
+	case "left":
+		robotgo.Toggle("left", state)
+	case "right":
+		robotgo.Toggle("right", state)
+	case "middle":
+		robotgo.Toggle("center", state)
+	case "x1":
+		robotgo.Toggle("center", state) // back button → middle on Windows (original mapping)
+	case "x2":
+		robotgo.Toggle("right", state)
+	}
+}
+
+// Scroll sends a scroll event via robotgo.
+func (robotgoSink) Scroll(dx, dy int) {
+	robotgo.Scroll(dx, -dy)
+}
+
+func (robotgoSink) Close() error { return nil }
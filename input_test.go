@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestSinkNames(t *testing.T) {
+	names := sinkNames()
+	if !sort.StringsAreSorted(names) {
+		t.Errorf("sinkNames() = %v, not sorted", names)
+	}
+	for _, want := range []string{"noop", "record"} {
+		if i := sort.SearchStrings(names, want); i == len(names) || names[i] != want {
+			t.Errorf("sinkNames() = %v, missing %s", names, want)
+		}
+	}
+}
+
+func TestRegisterSinkTwice(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("registering a backend name twice didn't panic")
+		}
+	}()
+	registerSink("record", func(sinkOptions) (InputSink, error) { return &recordSink{}, nil })
+}
+
+func TestNewSinkUnknown(t *testing.T) {
+	_, err := newSink("nosuchbackend", sinkOptions{})
+	if err == nil {
+		t.Fatal("newSink of an unknown backend succeeded")
+	}
+	if !strings.Contains(err.Error(), strings.Join(sinkNames(), ", ")) {
+		t.Errorf("error %q doesn't list the available backends", err)
+	}
+}
+
+func TestRecordSink(t *testing.T) {
+	s, err := newSink("noop", sinkOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	sink := s.(*recordSink)
+
+	sink.Move(10, 20)
+	sink.Key("Return", true)
+	sink.Key("Return", false)
+	sink.Click("left", true)
+	sink.Scroll(0, -1)
+	want := []string{"move 10 20", "key Return down", "key Return up", "click left down", "scroll 0 -1"}
+	if got := sink.Events(); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("Events() = %q, want %q", got, want)
+	}
+	if got := sink.Events(); len(got) != 0 {
+		t.Errorf("Events() = %q after reading them, want none", got)
+	}
+
+	// Only the latest events are kept.
+	for i := 0; i < maxRecordedEvents+10; i++ {
+		sink.Move(i, 0)
+	}
+	got := sink.Events()
+	if len(got) != maxRecordedEvents || got[0] != "move 10 0" {
+		t.Errorf("kept %d events starting with %q, want %d starting with %q", len(got), got[0], maxRecordedEvents, "move 10 0")
+	}
+}
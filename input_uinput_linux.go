@@ -0,0 +1,383 @@
+//go:build linux
+
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"syscall"
+)
+
+func init() {
+	registerSink("uinput", newUinputSink)
+}
+
+// uinput ioctls (linux/uinput.h).
+const (
+	uiDevCreate  = 0x5501
+	uiDevDestroy = 0x5502
+	uiSetEvBit   = 0x40045564
+	uiSetKeyBit  = 0x40045565
+	uiSetRelBit  = 0x40045566
+	uiSetAbsBit  = 0x40045567
+)
+
+// Event types and codes (linux/input-event-codes.h).
+const (
+	evSyn = 0x00
+	evKey = 0x01
+	evRel = 0x02
+	evAbs = 0x03
+
+	synReport = 0x00
+	relX      = 0x00
+	relY      = 0x01
+	relHWheel = 0x06
+	relWheel  = 0x08
+	absX      = 0x00
+	absY      = 0x01
+
+	// The high-resolution wheels count 1/120 of a notch.
+	relWheelHiRes  = 0x0b
+	relHWheelHiRes = 0x0c
+
+	busVirtual = 0x06
+)
+
+// uinputUserDev is struct uinput_user_dev, written once before UI_DEV_CREATE.
+type uinputUserDev struct {
+	Name         [80]byte
+	Bustype      uint16
+	Vendor       uint16
+	Product      uint16
+	Version      uint16
+	FFEffectsMax uint32
+	Absmax       [64]int32
+	Absmin       [64]int32
+	Absfuzz      [64]int32
+	Absflat      [64]int32
+}
+
+// inputEvent is struct input_event. The kernel fills in the time.
+type inputEvent struct {
+	Time  syscall.Timeval
+	Type  uint16
+	Code  uint16
+	Value int32
+}
+
+// uinputDevice is a virtual input device created through /dev/uinput.
+type uinputDevice struct {
+	f *os.File
+	// chardev is false when writing to a regular file instead of the
+	// uinput node, in which case the ioctls are skipped and only the
+	// device description and events are written.
+	chardev bool
+}
+
+func openUinputDevice(path string) (*uinputDevice, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &uinputDevice{f: f, chardev: fi.Mode()&os.ModeCharDevice != 0}, nil
+}
+
+func (d *uinputDevice) ioctl(req, arg uintptr) error {
+	if !d.chardev {
+		return nil
+	}
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, d.f.Fd(), req, arg)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// setBit is the UI_SET_*BIT ioctl enabling the codes of each event type.
+var setBit = map[uint16]uintptr{
+	evKey: uiSetKeyBit,
+	evRel: uiSetRelBit,
+	evAbs: uiSetAbsBit,
+}
+
+// create registers the supported event codes, by event type, and creates
+// the device.
+func (d *uinputDevice) create(dev uinputUserDev, codes map[uint16][]uint16) error {
+	for typ, cs := range codes {
+		if err := d.ioctl(uiSetEvBit, uintptr(typ)); err != nil {
+			return fmt.Errorf("UI_SET_EVBIT %d: %w", typ, err)
+		}
+		for _, c := range cs {
+			if err := d.ioctl(setBit[typ], uintptr(c)); err != nil {
+				return fmt.Errorf("enable code %d/%d: %w", typ, c, err)
+			}
+		}
+	}
+	if err := binary.Write(d.f, binary.LittleEndian, &dev); err != nil {
+		return fmt.Errorf("write device: %w", err)
+	}
+	if err := d.ioctl(uiDevCreate, 0); err != nil {
+		return fmt.Errorf("UI_DEV_CREATE: %w", err)
+	}
+	return nil
+}
+
+// emit writes the events followed by a SYN_REPORT.
+func (d *uinputDevice) emit(events ...inputEvent) error {
+	events = append(events, inputEvent{Type: evSyn, Code: synReport})
+	// input_event uses the native byte order, which is little endian on
+	// every platform we support.
+	return binary.Write(d.f, binary.LittleEndian, events)
+}
+
+func (d *uinputDevice) Close() error {
+	if err := d.ioctl(uiDevDestroy, 0); err != nil {
+		log.Printf("uinput: UI_DEV_DESTROY: %v", err)
+	}
+	return d.f.Close()
+}
+
+// uinputSink creates a virtual absolute pointer, a relative pointer and a
+// keyboard. It works under X11, Wayland and gamescope alike and needs no
+// helper process, only write access to /dev/uinput.
+type uinputSink struct {
+	mu       sync.Mutex
+	pointer  *uinputDevice
+	relative *uinputDevice
+	keyboard *uinputDevice
+	// width and height of the desktop the absolute axes span.
+	width, height int
+	// hiResX/Y are the high-resolution scroll fractions not yet sent as
+	// whole notches.
+	hiResX, hiResY int
+}
+
+func newUinputSink(opts sinkOptions) (InputSink, error) {
+	pointer, err := openUinputDevice(opts.uinputPath)
+	if err != nil {
+		return nil, err
+	}
+	relative, err := openUinputDevice(opts.uinputPath)
+	if err != nil {
+		pointer.Close()
+		return nil, err
+	}
+	keyboard, err := openUinputDevice(opts.uinputPath)
+	if err != nil {
+		pointer.Close()
+		relative.Close()
+		return nil, err
+	}
+	closeAll := func() {
+		pointer.Close()
+		relative.Close()
+		keyboard.Close()
+	}
+
+	// The absolute axes span the desktop in pixels, the compositor maps
+	// them onto all monitors.
+	width, height := desktopSize()
+	pdev := uinputUserDev{Bustype: busVirtual, Vendor: 0x4d34, Product: 1, Version: 1}
+	copy(pdev.Name[:], "magic4pc pointer")
+	pdev.Absmax[absX] = int32(width) - 1
+	pdev.Absmax[absY] = int32(height) - 1
+	var buttons []uint16
+	for _, b := range evdevButtons {
+		buttons = append(buttons, b)
+	}
+	err = pointer.create(pdev, map[uint16][]uint16{
+		evKey: buttons,
+		evAbs: {absX, absY},
+		evRel: {relWheel, relHWheel, relWheelHiRes, relHWheelHiRes},
+	})
+	if err != nil {
+		closeAll()
+		return nil, fmt.Errorf("uinput pointer: %w", err)
+	}
+
+	// Relative motion needs its own device, libinput won't mix it with
+	// absolute axes. The buttons make it classify as a mouse.
+	rdev := uinputUserDev{Bustype: busVirtual, Vendor: 0x4d34, Product: 3, Version: 1}
+	copy(rdev.Name[:], "magic4pc relative pointer")
+	err = relative.create(rdev, map[uint16][]uint16{
+		evKey: buttons,
+		evRel: {relX, relY},
+	})
+	if err != nil {
+		closeAll()
+		return nil, fmt.Errorf("uinput relative pointer: %w", err)
+	}
+
+	kdev := uinputUserDev{Bustype: busVirtual, Vendor: 0x4d34, Product: 2, Version: 1}
+	copy(kdev.Name[:], "magic4pc keyboard")
+	// Every key, typing may need any of them on the active layout.
+	var keyCodes []uint16
+	for k := uint16(1); k < evBtnMouse; k++ {
+		keyCodes = append(keyCodes, k)
+	}
+	if err := keyboard.create(kdev, map[uint16][]uint16{evKey: keyCodes}); err != nil {
+		closeAll()
+		return nil, fmt.Errorf("uinput keyboard: %w", err)
+	}
+
+	log.Printf("uinput: created virtual pointers and keyboard on %s", opts.uinputPath)
+	return &uinputSink{pointer: pointer, relative: relative, keyboard: keyboard, width: width, height: height}, nil
+}
+
+func (s *uinputSink) emit(d *uinputDevice, events ...inputEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := d.emit(events...); err != nil {
+		log.Printf("uinput: write events: %v", err)
+	}
+}
+
+// Move the pointer to x, y.
+func (s *uinputSink) Move(x, y int) {
+	x = clamp(x, 0, s.width-1)
+	y = clamp(y, 0, s.height-1)
+	s.emit(s.pointer,
+		inputEvent{Type: evAbs, Code: absX, Value: int32(x)},
+		inputEvent{Type: evAbs, Code: absY, Value: int32(y)},
+	)
+}
+
+// MoveRelative moves the pointer by dx, dy.
+func (s *uinputSink) MoveRelative(dx, dy int) {
+	s.emit(s.relative,
+		inputEvent{Type: evRel, Code: relX, Value: int32(dx)},
+		inputEvent{Type: evRel, Code: relY, Value: int32(dy)},
+	)
+}
+
+// Key sends a key down or up event.
+func (s *uinputSink) Key(key string, down bool) {
+	code, ok := evdevKey(key)
+	if !ok {
+		log.Printf("uinput: unknown key %q", key)
+		return
+	}
+	s.emit(s.keyboard, inputEvent{Type: evKey, Code: code, Value: boolValue(down)})
+}
+
+// Type types text on the virtual keyboard with the keys of the active
+// layout, or those of a US layout when it can't be read, see typeKeys.
+func (s *uinputSink) Type(text string) {
+	km := activeKeymap()
+	if km == nil {
+		typeKeys(s, text)
+		return
+	}
+	for _, codes := range km.strokes(text, canCompose) {
+		for _, c := range codes {
+			s.emit(s.keyboard, inputEvent{Type: evKey, Code: c, Value: 1})
+		}
+		for i := len(codes) - 1; i >= 0; i-- {
+			s.emit(s.keyboard, inputEvent{Type: evKey, Code: codes[i], Value: 0})
+		}
+	}
+}
+
+// Click sends a mouse button down or up event.
+func (s *uinputSink) Click(button string, down bool) {
+	code, ok := evdevButtons[button]
+	if !ok {
+		return
+	}
+	s.emit(s.pointer, inputEvent{Type: evKey, Code: code, Value: boolValue(down)})
+}
+
+// Scroll moves the wheels by dx, dy notches.
+func (s *uinputSink) Scroll(dx, dy int) {
+	var events []inputEvent
+	if dy != 0 {
+		events = append(events,
+			inputEvent{Type: evRel, Code: relWheelHiRes, Value: int32(dy * hiResNotch)},
+			inputEvent{Type: evRel, Code: relWheel, Value: int32(dy)},
+		)
+	}
+	if dx != 0 {
+		events = append(events,
+			inputEvent{Type: evRel, Code: relHWheelHiRes, Value: int32(dx * hiResNotch)},
+			inputEvent{Type: evRel, Code: relHWheel, Value: int32(dx)},
+		)
+	}
+	if len(events) > 0 {
+		s.emit(s.pointer, events...)
+	}
+}
+
+// ScrollHiRes moves the wheels by dx, dy 1/120 notches. Like a real
+// high-resolution mouse it also sends the classic wheel events, once the
+// fractions add up to a notch.
+func (s *uinputSink) ScrollHiRes(dx, dy int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hiResX += dx
+	s.hiResY += dy
+	notchX, notchY := s.hiResX/hiResNotch, s.hiResY/hiResNotch
+	s.hiResX -= notchX * hiResNotch
+	s.hiResY -= notchY * hiResNotch
+
+	var events []inputEvent
+	if dy != 0 {
+		events = append(events, inputEvent{Type: evRel, Code: relWheelHiRes, Value: int32(dy)})
+	}
+	if dx != 0 {
+		events = append(events, inputEvent{Type: evRel, Code: relHWheelHiRes, Value: int32(dx)})
+	}
+	if notchY != 0 {
+		events = append(events, inputEvent{Type: evRel, Code: relWheel, Value: int32(notchY)})
+	}
+	if notchX != 0 {
+		events = append(events, inputEvent{Type: evRel, Code: relHWheel, Value: int32(notchX)})
+	}
+	if len(events) == 0 {
+		return
+	}
+	if err := s.pointer.emit(events...); err != nil {
+		log.Printf("uinput: write events: %v", err)
+	}
+}
+
+// Close destroys the virtual devices.
+func (s *uinputSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var err error
+	for _, d := range []*uinputDevice{s.pointer, s.relative, s.keyboard} {
+		if cerr := d.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// kernelLevel marks the sink as injecting events below the display server.
+func (s *uinputSink) kernelLevel() {}
+
+func boolValue(b bool) int32 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func clamp(v, lo, hi int) int {
+	if v < lo {
+		return lo
+	}
+	if v > hi {
+		return hi
+	}
+	return v
+}
@@ -0,0 +1,112 @@
+//go:build linux
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// uinputRecording reads what a uinputSink wrote to a regular file: the
+// device descriptions of the pointer, relative pointer and keyboard, then
+// the events.
+func uinputRecording(t *testing.T, path string) ([]uinputUserDev, []inputEvent) {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := bytes.NewReader(b)
+	devs := make([]uinputUserDev, 3)
+	if err := binary.Read(r, binary.LittleEndian, devs); err != nil {
+		t.Fatalf("read device descriptions: %v", err)
+	}
+	var ev inputEvent
+	if r.Len()%binary.Size(ev) != 0 {
+		t.Fatalf("%d bytes of events is not a whole number of events", r.Len())
+	}
+	events := make([]inputEvent, r.Len()/binary.Size(ev))
+	if err := binary.Read(r, binary.LittleEndian, events); err != nil {
+		t.Fatalf("read events: %v", err)
+	}
+	return devs, events
+}
+
+func TestUinputSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "uinput")
+	if err := os.WriteFile(path, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	s, err := newUinputSink(sinkOptions{uinputPath: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	s.Move(100, 200)
+	s.Move(-5, 5000)
+	s.MoveRelative(-3, 4)
+	s.Key("a", true)
+	s.Key("a", false)
+	s.Key("nosuchkey", true)
+	s.Click("left", true)
+	s.Scroll(0, -1)
+	s.(hiResScroller).ScrollHiRes(0, 60)
+	s.(hiResScroller).ScrollHiRes(0, 60)
+	s.(hiResScroller).ScrollHiRes(-30, 0)
+
+	devs, events := uinputRecording(t, path)
+	for i, want := range []string{"magic4pc pointer", "magic4pc relative pointer", "magic4pc keyboard"} {
+		if got := string(bytes.TrimRight(devs[i].Name[:], "\x00")); got != want {
+			t.Errorf("device %d is %q, want %q", i, got, want)
+		}
+		if devs[i].Bustype != busVirtual {
+			t.Errorf("device %d is on bus %d, want %d", i, devs[i].Bustype, busVirtual)
+		}
+	}
+
+	syn := inputEvent{Type: evSyn, Code: synReport}
+	want := []inputEvent{
+		{Type: evAbs, Code: absX, Value: 100},
+		{Type: evAbs, Code: absY, Value: 200},
+		syn,
+		// Positions are clamped to the TV coordinate space.
+		{Type: evAbs, Code: absX, Value: 0},
+		{Type: evAbs, Code: absY, Value: 1079},
+		syn,
+		{Type: evRel, Code: relX, Value: -3},
+		{Type: evRel, Code: relY, Value: 4},
+		syn,
+		{Type: evKey, Code: 30, Value: 1}, // KEY_A
+		syn,
+		{Type: evKey, Code: 30, Value: 0},
+		syn,
+		{Type: evKey, Code: evBtnLeft, Value: 1},
+		syn,
+		{Type: evRel, Code: relWheelHiRes, Value: -120},
+		{Type: evRel, Code: relWheel, Value: -1},
+		syn,
+		// Half a notch only scrolls high-resolution clients, the second
+		// half completes a notch.
+		{Type: evRel, Code: relWheelHiRes, Value: 60},
+		syn,
+		{Type: evRel, Code: relWheelHiRes, Value: 60},
+		{Type: evRel, Code: relWheel, Value: 1},
+		syn,
+		{Type: evRel, Code: relHWheelHiRes, Value: -30},
+		syn,
+	}
+	if len(events) != len(want) {
+		t.Fatalf("got %d events, want %d: %+v", len(events), len(want), events)
+	}
+	for i := range want {
+		got := events[i]
+		if got.Type != want[i].Type || got.Code != want[i].Code || got.Value != want[i].Value {
+			t.Errorf("event %d is type %d code %d value %d, want type %d code %d value %d",
+				i, got.Type, got.Code, got.Value, want[i].Type, want[i].Code, want[i].Value)
+		}
+	}
+}
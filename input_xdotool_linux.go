@@ -0,0 +1,228 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+func init() {
+	registerSink("xdotool", newXdotoolSink)
+}
+
+// xdotoolSink drives a persistent `xdotool -` process through its stdin.
+type xdotoolSink struct {
+	// cmdCh carries all xdotool commands (keys, clicks).
+	// moveCh carries mouse moves — buffered 1, drops stale coords.
+	moveCh chan [2]int
+	rel    *motionAccumulator
+	cmdCh  chan string
+	done   chan struct{}
+}
+
+// newXdotoolSink starts the persistent xdotool worker goroutine.
+func newXdotoolSink(sinkOptions) (InputSink, error) {
+	s := &xdotoolSink{
+		moveCh: make(chan [2]int, 1),
+		rel:    newMotionAccumulator(),
+		cmdCh:  make(chan string, 64),
+		done:   make(chan struct{}),
+	}
+	go s.worker()
+	return s, nil
+}
+
+// Move sends the pointer position to xdotool.
+func (s *xdotoolSink) Move(x, y int) {
+	select {
+	case s.moveCh <- [2]int{x, y}:
+	default:
+		select {
+		case <-s.moveCh:
+		default:
+		}
+		s.moveCh <- [2]int{x, y}
+	}
+}
+
+// MoveRelative moves the pointer by dx, dy pixels.
+func (s *xdotoolSink) MoveRelative(dx, dy int) {
+	s.rel.add(dx, dy)
+}
+
+// Key sends a key down or up event via xdotool.
+func (s *xdotoolSink) Key(key string, down bool) {
+	if down {
+		s.cmd("keydown", key)
+	} else {
+		s.cmd("keyup", key)
+	}
+}
+
+// Type types text as Unicode keysyms, xdotool maps a spare keycode for
+// those missing from the keyboard layout.
+func (s *xdotoolSink) Type(text string) {
+	for _, r := range text {
+		switch r {
+		case '\n':
+			s.cmd("key", "Return")
+		case '\t':
+			s.cmd("key", "Tab")
+		case '\r':
+		default:
+			s.cmd("key", fmt.Sprintf("U%04X", r))
+		}
+	}
+}
+
+// Click sends a mouse button down or up event via xdotool.
+func (s *xdotoolSink) Click(button string, down bool) {
+	var btn string
+	switch button {
+	case "left":
+		btn = "1"
+	case "middle":
+		btn = "2"
+	case "right":
+		btn = "3"
+	case "x1":
+		btn = "8"
+	case "x2":
+		btn = "9"
+	default:
+		return
+	}
+	if down {
+		s.cmd("mousedown", btn)
+	} else {
+		s.cmd("mouseup", btn)
+	}
+}
+
+// Scroll clicks the wheel buttons, 4 and 5 scroll up and down, 6 and 7
+// left and right.
+func (s *xdotoolSink) Scroll(dx, dy int) {
+	if dy != 0 {
+		s.cmd("click", "--repeat", strconv.Itoa(abs(dy)), pick(dy > 0, "4", "5"))
+	}
+	if dx != 0 {
+		s.cmd("click", "--repeat", strconv.Itoa(abs(dx)), pick(dx > 0, "7", "6"))
+	}
+}
+
+func pick(cond bool, a, b string) string {
+	if cond {
+		return a
+	}
+	return b
+}
+
+// Close stops the worker and the xdotool process.
+func (s *xdotoolSink) Close() error {
+	close(s.done)
+	return nil
+}
+
+func (s *xdotoolSink) cmd(args ...string) {
+	select {
+	case s.cmdCh <- strings.Join(args, " "):
+	case <-s.done:
+	}
+}
+
+func (s *xdotoolSink) worker() {
+	var (
+		mu    sync.Mutex
+		stdin io.WriteCloser
+		cmd   *exec.Cmd
+	)
+
+	stopXdotool := func() {
+		if stdin != nil {
+			stdin.Close()
+			stdin = nil
+		}
+		if cmd != nil {
+			cmd.Wait()
+			cmd = nil
+		}
+	}
+
+	startXdotool := func(disp, xauth string) {
+		mu.Lock()
+		defer mu.Unlock()
+		stopXdotool()
+		c := exec.Command("/usr/bin/xdotool", "-")
+		c.Env = append(os.Environ(), "DISPLAY="+disp, "XAUTHORITY="+xauth)
+		in, err := c.StdinPipe()
+		if err != nil {
+			log.Printf("xdotool StdinPipe: %v", err)
+			return
+		}
+		if err := c.Start(); err != nil {
+			log.Printf("xdotool Start: %v", err)
+			return
+		}
+		cmd = c
+		stdin = in
+		log.Printf("xdotool started on %s", disp)
+	}
+
+	write := func(line string) {
+		for attempts := 0; attempts < 3; attempts++ {
+			mu.Lock()
+			in := stdin
+			mu.Unlock()
+			if in == nil {
+				time.Sleep(time.Duration(500+attempts*500) * time.Millisecond)
+				disp, xauth := getXDisplay()
+				if disp == "" {
+					disp = ":0"
+				}
+				startXdotool(disp, xauth)
+				continue
+			}
+			if _, err := fmt.Fprintf(in, "%s\n", line); err == nil {
+				return
+			}
+			log.Printf("xdotool write error, retrying in 1s...")
+			mu.Lock()
+			stopXdotool()
+			mu.Unlock()
+			time.Sleep(time.Second)
+		}
+	}
+
+	// Initial start
+	disp, xauth := getXDisplay()
+	if disp == "" {
+		disp = ":0"
+	}
+	startXdotool(disp, xauth)
+
+	for {
+		select {
+		case <-s.done:
+			mu.Lock()
+			stopXdotool()
+			mu.Unlock()
+			return
+		case pos := <-s.moveCh:
+			write(fmt.Sprintf("mousemove %d %d", pos[0], pos[1]))
+		case <-s.rel.ready:
+			if dx, dy := s.rel.take(); dx != 0 || dy != 0 {
+				write(fmt.Sprintf("mousemove_relative -- %d %d", dx, dy))
+			}
+		case line := <-s.cmdCh:
+			write(line)
+		}
+	}
+}
@@ -0,0 +1,203 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"unicode"
+	"unicode/utf8"
+)
+
+func init() {
+	registerSink("ydotool", newYdotoolSink)
+}
+
+// ydotoolButtons maps InputSink button names to ydotool click codes.
+var ydotoolButtons = map[string]int{
+	"left":   0x00,
+	"right":  0x01,
+	"middle": 0x02,
+	"x1":     0x03,
+	"x2":     0x04,
+}
+
+// ydotool flags for click codes.
+const (
+	ydotoolButtonDown = 0x40
+	ydotoolButtonUp   = 0x80
+)
+
+// ydotoolSink runs /usr/bin/ydotool for every event, it works wherever
+// ydotoold can reach /dev/uinput, including pure Wayland sessions.
+type ydotoolSink struct {
+	// moveCh carries mouse moves — buffered 1, drops stale coords.
+	moveCh chan [2]int
+	rel    *motionAccumulator
+	cmdCh  chan []string
+	done   chan struct{}
+}
+
+func newYdotoolSink(sinkOptions) (InputSink, error) {
+	if _, err := exec.LookPath("/usr/bin/ydotool"); err != nil {
+		return nil, err
+	}
+
+	s := &ydotoolSink{
+		moveCh: make(chan [2]int, 1),
+		rel:    newMotionAccumulator(),
+		cmdCh:  make(chan []string, 64),
+		done:   make(chan struct{}),
+	}
+	go s.worker()
+	return s, nil
+}
+
+// Move moves the pointer to x, y.
+func (s *ydotoolSink) Move(x, y int) {
+	select {
+	case s.moveCh <- [2]int{x, y}:
+	default:
+		select {
+		case <-s.moveCh:
+		default:
+		}
+		s.moveCh <- [2]int{x, y}
+	}
+}
+
+// MoveRelative moves the pointer by dx, dy pixels.
+func (s *ydotoolSink) MoveRelative(dx, dy int) {
+	s.rel.add(dx, dy)
+}
+
+// Key sends a key down or up event by its evdev code.
+func (s *ydotoolSink) Key(key string, down bool) {
+	code, ok := evdevKey(key)
+	if !ok {
+		log.Printf("ydotool: unknown key %q", key)
+		return
+	}
+	state := 0
+	if down {
+		state = 1
+	}
+	s.cmd("key", fmt.Sprintf("%d:%d", code, state))
+}
+
+// Type types text with the keys of the active layout. When it can't be
+// read, ASCII text is typed with ydotool type, which knows the US layout,
+// and other characters are composed with Ctrl+Shift+U.
+func (s *ydotoolSink) Type(text string) {
+	if km := activeKeymap(); km != nil {
+		args := []string{"key"}
+		for _, codes := range km.strokes(text, canCompose) {
+			for _, c := range codes {
+				args = append(args, fmt.Sprintf("%d:1", c))
+			}
+			for i := len(codes) - 1; i >= 0; i-- {
+				args = append(args, fmt.Sprintf("%d:0", codes[i]))
+			}
+		}
+		if len(args) > 1 {
+			s.cmd(args...)
+		}
+		return
+	}
+
+	compose := composeCheck()
+	start := 0
+	for i, r := range text {
+		if r < unicode.MaxASCII {
+			continue
+		}
+		if start < i {
+			s.cmd("type", "--", text[start:i])
+		}
+		composeRune(s, r, compose)
+		start = i + utf8.RuneLen(r)
+	}
+	if start < len(text) {
+		s.cmd("type", "--", text[start:])
+	}
+}
+
+// Click sends a mouse button down or up event.
+func (s *ydotoolSink) Click(button string, down bool) {
+	btn, ok := ydotoolButtons[button]
+	if !ok {
+		return
+	}
+	if down {
+		btn |= ydotoolButtonDown
+	} else {
+		btn |= ydotoolButtonUp
+	}
+	s.cmd("click", fmt.Sprintf("0x%02X", btn))
+}
+
+// Scroll moves the wheels by dx, dy notches.
+func (s *ydotoolSink) Scroll(dx, dy int) {
+	s.cmd("mousemove", "--wheel", "-x", strconv.Itoa(dx), "-y", strconv.Itoa(dy))
+}
+
+// Close stops the worker.
+func (s *ydotoolSink) Close() error {
+	close(s.done)
+	return nil
+}
+
+// kernelLevel marks the sink as injecting events below the display server.
+func (s *ydotoolSink) kernelLevel() {}
+
+func (s *ydotoolSink) cmd(args ...string) {
+	select {
+	case s.cmdCh <- args:
+	case <-s.done:
+	}
+}
+
+func (s *ydotoolSink) worker() {
+	for {
+		var err error
+		select {
+		case <-s.done:
+			return
+		case pos := <-s.moveCh:
+			err = ydotool("mousemove", "--absolute", "-x", strconv.Itoa(pos[0]), "-y", strconv.Itoa(pos[1]))
+		case <-s.rel.ready:
+			if dx, dy := s.rel.take(); dx != 0 || dy != 0 {
+				err = ydotool("mousemove", "-x", strconv.Itoa(dx), "-y", strconv.Itoa(dy))
+			}
+		case args := <-s.cmdCh:
+			err = ydotool(args...)
+		}
+		if err != nil {
+			log.Printf("ydotool: %v", err)
+		}
+	}
+}
+
+// ydotool runs a single ydotool command against the ydotoold socket.
+func ydotool(args ...string) error {
+	cmd := exec.Command("/usr/bin/ydotool", args...)
+	cmd.Env = os.Environ()
+	if os.Getenv("YDOTOOL_SOCKET") == "" {
+		cmd.Env = append(cmd.Env, "YDOTOOL_SOCKET="+ydotoolSocket())
+	}
+	return cmd.Run()
+}
+
+// ydotoolSocket returns where ydotoold listens when run as the user, in
+// the user's runtime directory.
+func ydotoolSocket() string {
+	dir := os.Getenv("XDG_RUNTIME_DIR")
+	if dir == "" {
+		dir = fmt.Sprintf("/run/user/%d", os.Getuid())
+	}
+	return filepath.Join(dir, ".ydotool_socket")
+}
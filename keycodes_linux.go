@@ -0,0 +1,130 @@
+//go:build linux
+
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Linux input event codes (linux/input-event-codes.h) for the keys and
+// buttons we inject.
+const (
+	evKeyEsc            = 1
+	evKeyMinus          = 12
+	evKeyEqual          = 13
+	evKeyBackspace      = 14
+	evKeyTab            = 15
+	evKeyLeftBrace      = 26
+	evKeyRightBrace     = 27
+	evKeyEnter          = 28
+	evKeyLeftCtrl       = 29
+	evKeySemicolon      = 39
+	evKeyApostrophe     = 40
+	evKeyGrave          = 41
+	evKeyLeftShift      = 42
+	evKeyBackslash      = 43
+	evKeyComma          = 51
+	evKeyDot            = 52
+	evKeySlash          = 53
+	evKeyRightShift     = 54
+	evKeyLeftAlt        = 56
+	evKeySpace          = 57
+	evKeyCapsLock       = 58
+	evKeyF1             = 59
+	evKeyF11            = 87
+	evKeyF12            = 88
+	evKeyRightCtrl      = 97
+	evKeyRightAlt       = 100
+	evKeyHome           = 102
+	evKeyUp             = 103
+	evKeyPageUp         = 104
+	evKeyLeft           = 105
+	evKeyRight          = 106
+	evKeyEnd            = 107
+	evKeyDown           = 108
+	evKeyPageDown       = 109
+	evKeyInsert         = 110
+	evKeyDelete         = 111
+	evKeyMute           = 113
+	evKeyVolumeDown     = 114
+	evKeyVolumeUp       = 115
+	evKeyLeftMeta       = 125
+	evKeyRightMeta      = 126
+	evKeyMenu           = 139
+	evKeyNextSong       = 163
+	evKeyPlayPause      = 164
+	evKeyPreviousSong   = 165
+	evKeyStopCD         = 166
+	evKeyPlayCD         = 200
+	evKeyPauseCD        = 201
+	evKeyBrightnessDown = 224
+	evKeyBrightnessUp   = 225
+
+	evBtnMouse  = 0x110
+	evBtnLeft   = 0x110
+	evBtnRight  = 0x111
+	evBtnMiddle = 0x112
+	evBtnSide   = 0x113
+	evBtnExtra  = 0x114
+)
+
+// evdevKeys maps lowercased X keysym names (and the characters they produce
+// on a US layout) to key codes.
+var evdevKeys = map[string]uint16{
+	"escape": evKeyEsc, "minus": evKeyMinus, "-": evKeyMinus, "equal": evKeyEqual, "=": evKeyEqual,
+	"backspace": evKeyBackspace, "tab": evKeyTab,
+	"bracketleft": evKeyLeftBrace, "[": evKeyLeftBrace, "bracketright": evKeyRightBrace, "]": evKeyRightBrace,
+	"return": evKeyEnter, "enter": evKeyEnter,
+	"ctrl": evKeyLeftCtrl, "control": evKeyLeftCtrl, "control_l": evKeyLeftCtrl, "control_r": evKeyRightCtrl,
+	"semicolon": evKeySemicolon, ";": evKeySemicolon, "apostrophe": evKeyApostrophe, "'": evKeyApostrophe,
+	"grave": evKeyGrave, "`": evKeyGrave,
+	"shift": evKeyLeftShift, "shift_l": evKeyLeftShift, "shift_r": evKeyRightShift,
+	"backslash": evKeyBackslash, "\\": evKeyBackslash,
+	"comma": evKeyComma, ",": evKeyComma, "period": evKeyDot, ".": evKeyDot, "slash": evKeySlash, "/": evKeySlash,
+	"alt": evKeyLeftAlt, "alt_l": evKeyLeftAlt, "alt_r": evKeyRightAlt,
+	"space": evKeySpace, " ": evKeySpace, "caps_lock": evKeyCapsLock,
+	"f11": evKeyF11, "f12": evKeyF12,
+	"home": evKeyHome, "up": evKeyUp, "prior": evKeyPageUp, "page_up": evKeyPageUp,
+	"left": evKeyLeft, "right": evKeyRight, "end": evKeyEnd, "down": evKeyDown,
+	"next": evKeyPageDown, "page_down": evKeyPageDown, "insert": evKeyInsert, "delete": evKeyDelete,
+	"super": evKeyLeftMeta, "super_l": evKeyLeftMeta, "super_r": evKeyRightMeta, "menu": evKeyMenu,
+	"xf86audiomute": evKeyMute, "xf86audiolowervolume": evKeyVolumeDown, "xf86audioraisevolume": evKeyVolumeUp,
+	"xf86audionext": evKeyNextSong, "xf86audioplay": evKeyPlayPause, "xf86audioprev": evKeyPreviousSong,
+	"xf86audiostop": evKeyStopCD, "xf86audiopause": evKeyPauseCD,
+	"xf86monbrightnessdown": evKeyBrightnessDown, "xf86monbrightnessup": evKeyBrightnessUp,
+}
+
+func init() {
+	// Letters and digits follow the keyboard rows.
+	for i, c := range "qwertyuiop" {
+		evdevKeys[string(c)] = uint16(16 + i)
+	}
+	for i, c := range "asdfghjkl" {
+		evdevKeys[string(c)] = uint16(30 + i)
+	}
+	for i, c := range "zxcvbnm" {
+		evdevKeys[string(c)] = uint16(44 + i)
+	}
+	for i, c := range "1234567890" {
+		evdevKeys[string(c)] = uint16(2 + i)
+	}
+	for i := 0; i < 10; i++ {
+		evdevKeys["f"+strconv.Itoa(i+1)] = uint16(evKeyF1 + i)
+	}
+}
+
+// evdevKey looks up the key code for an X keysym name.
+func evdevKey(name string) (uint16, bool) {
+	code, ok := evdevKeys[strings.ToLower(name)]
+	return code, ok
+}
+
+// evdevButtons maps InputSink button names to button codes.
+var evdevButtons = map[string]uint16{
+	"left":   evBtnLeft,
+	"right":  evBtnRight,
+	"middle": evBtnMiddle,
+	"x1":     evBtnSide,
+	"x2":     evBtnExtra,
+}
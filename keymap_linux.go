@@ -0,0 +1,259 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// keymapRefresh is how long a keymap is used before it is read again, to
+// follow layout changes.
+const keymapRefresh = time.Minute
+
+// xkbKeymap is where the characters are on the keyboard layout of the
+// display server, for the backends that can only send key codes. Only the
+// first layout (group) is used, with Shift and AltGr.
+type xkbKeymap struct {
+	keys map[rune]xkbKey
+	// altGr is the key code of ISO_Level3_Shift, 0 if there is none.
+	altGr uint16
+}
+
+// xkbKey is a key code and the shift level it types a character at: 0
+// plain, 1 with Shift, 2 with AltGr, 3 with Shift and AltGr.
+type xkbKey struct {
+	code  uint16
+	level int
+}
+
+// keymaps caches the keymap of the X display.
+var keymaps struct {
+	mu     sync.Mutex
+	m      *xkbKeymap
+	read   time.Time
+	warned bool
+}
+
+// activeKeymap returns the keymap of the X (or Xwayland) display, or nil
+// when xkbcomp can't read it.
+func activeKeymap() *xkbKeymap {
+	keymaps.mu.Lock()
+	defer keymaps.mu.Unlock()
+	if !keymaps.read.IsZero() && time.Since(keymaps.read) < keymapRefresh {
+		return keymaps.m
+	}
+	keymaps.read = time.Now()
+	m, err := readKeymap()
+	if err != nil {
+		if !keymaps.warned {
+			log.Printf("keymap: %v, typing with a US layout", err)
+			keymaps.warned = true
+		}
+		return keymaps.m
+	}
+	keymaps.m = m
+	return m
+}
+
+// readKeymap dumps the keymap of the X display with xkbcomp. Xwayland gets
+// its keymap from the compositor, so it is the one of Wayland sessions too.
+func readKeymap() (*xkbKeymap, error) {
+	disp, xauth := getXDisplay()
+	if disp == "" {
+		disp = ":0"
+	}
+	cmd := exec.Command("xkbcomp", "-xkb", disp, "-")
+	cmd.Env = append(os.Environ(), "DISPLAY="+disp, "XAUTHORITY="+xauth)
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("xkbcomp: %w", err)
+	}
+	return parseKeymap(string(out))
+}
+
+var (
+	xkbKeycodeRe = regexp.MustCompile(`<([^>]+)>\s*=\s*(\d+)\s*;`)
+	xkbAliasRe   = regexp.MustCompile(`alias\s+<([^>]+)>\s*=\s*<([^>]+)>\s*;`)
+	xkbKeyRe     = regexp.MustCompile(`(?s)\bkey\s+<([^>]+)>\s*\{(.*?)\}\s*;`)
+	xkbTypeRe    = regexp.MustCompile(`type(?:\[Group1\])?\s*=\s*"([^"]*)"`)
+	xkbGroup1Re  = regexp.MustCompile(`symbols\[Group1\]\s*=\s*\[([^\]]*)\]`)
+	xkbSymbolsRe = regexp.MustCompile(`(?:^|[^\w\]])\[([^\]]*)\]`)
+)
+
+// xkbLevelTypes are the key types whose levels are plain, Shift, AltGr and
+// Shift+AltGr. Keypad and other types use the levels differently.
+var xkbLevelTypes = []string{"ONE_LEVEL", "TWO_LEVEL", "ALPHABETIC", "FOUR_LEVEL", "EIGHT_LEVEL"}
+
+// parseKeymap reads the keycodes and symbols of xkbcomp -xkb output.
+func parseKeymap(s string) (*xkbKeymap, error) {
+	symbols := strings.Index(s, "xkb_symbols")
+	if symbols < 0 {
+		return nil, fmt.Errorf("xkbcomp: no xkb_symbols")
+	}
+	codes := make(map[string]uint16)
+	for _, m := range xkbKeycodeRe.FindAllStringSubmatch(s[:symbols], -1) {
+		code, err := strconv.Atoi(m[2])
+		// X key codes are the evdev ones plus 8.
+		if err == nil && code > 8 && code < 8+256 {
+			codes[m[1]] = uint16(code - 8)
+		}
+	}
+	for _, m := range xkbAliasRe.FindAllStringSubmatch(s[:symbols], -1) {
+		if code, ok := codes[m[2]]; ok {
+			codes[m[1]] = code
+		}
+	}
+
+	km := &xkbKeymap{keys: make(map[rune]xkbKey)}
+	section := s[symbols:]
+	if end := strings.Index(section, "xkb_geometry"); end >= 0 {
+		section = section[:end]
+	}
+	for _, m := range xkbKeyRe.FindAllStringSubmatch(section, -1) {
+		code, ok := codes[m[1]]
+		if !ok {
+			continue
+		}
+		body := m[2]
+		if t := xkbTypeRe.FindStringSubmatch(body); t != nil && !levelType(t[1]) {
+			continue
+		}
+		syms := xkbGroup1Re.FindStringSubmatch(body)
+		if syms == nil {
+			syms = xkbSymbolsRe.FindStringSubmatch(body)
+		}
+		if syms == nil {
+			continue
+		}
+		for level, name := range strings.Split(syms[1], ",") {
+			if level > 3 {
+				break
+			}
+			name = strings.TrimSpace(name)
+			if level == 0 && name == "ISO_Level3_Shift" && (km.altGr == 0 || m[1] == "RALT") {
+				km.altGr = code
+			}
+			r, ok := keysymRune(name)
+			if !ok {
+				continue
+			}
+			if k, ok := km.keys[r]; !ok || level < k.level {
+				km.keys[r] = xkbKey{code, level}
+			}
+		}
+	}
+	if len(km.keys) == 0 {
+		return nil, fmt.Errorf("xkbcomp: no characters in keymap")
+	}
+	return km, nil
+}
+
+func levelType(t string) bool {
+	if strings.Contains(t, "KEYPAD") {
+		return false
+	}
+	for _, p := range xkbLevelTypes {
+		if strings.HasPrefix(t, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// keysymRune returns the character of a keysym name.
+func keysymRune(name string) (rune, bool) {
+	if r, size := utf8.DecodeRuneInString(name); size > 0 && size == len(name) && r != utf8.RuneError {
+		return r, true
+	}
+	if r, ok := keysymRunes[name]; ok {
+		return r, true
+	}
+	// Unicode keysyms are U and the code point in hex, or 0x1000000 plus
+	// the code point when xkbcomp has no name for them.
+	if len(name) > 1 && name[0] == 'U' {
+		if v, err := strconv.ParseUint(name[1:], 16, 32); err == nil {
+			return rune(v), true
+		}
+	}
+	if strings.HasPrefix(name, "0x") {
+		if v, err := strconv.ParseUint(name[2:], 16, 32); err == nil && v >= 0x1000000 {
+			return rune(v - 0x1000000), true
+		}
+	}
+	return 0, false
+}
+
+// codes returns the key codes to press in order, and release in reverse,
+// to type r.
+func (m *xkbKeymap) codes(r rune) ([]uint16, bool) {
+	switch r {
+	case '\n':
+		return []uint16{evKeyEnter}, true
+	case '\t':
+		return []uint16{evKeyTab}, true
+	}
+	k, ok := m.keys[r]
+	if !ok || k.level >= 2 && m.altGr == 0 {
+		return nil, false
+	}
+	var codes []uint16
+	if k.level&1 != 0 {
+		codes = append(codes, evKeyLeftShift)
+	}
+	if k.level&2 != 0 {
+		codes = append(codes, m.altGr)
+	}
+	return append(codes, k.code), true
+}
+
+// strokes returns the key strokes typing text, each the key codes pressed
+// in order and released in reverse. Characters missing from the keymap are
+// composed while compose is set, see composeRune.
+func (m *xkbKeymap) strokes(text string, compose func() bool) [][]uint16 {
+	var strokes [][]uint16
+	// Whether to compose is checked once a character is missing.
+	var checked, composing bool
+	for _, r := range text {
+		if codes, ok := m.codes(r); ok {
+			strokes = append(strokes, codes)
+			continue
+		}
+		u, ok := m.codes('u')
+		if !ok || unicode.IsControl(r) {
+			log.Printf("input: can't type %q", r)
+			continue
+		}
+		if !checked {
+			checked, composing = true, compose()
+		}
+		if !composing {
+			log.Printf("input: can't type %q without IBus", r)
+			continue
+		}
+		seq := [][]uint16{append([]uint16{evKeyLeftCtrl, evKeyLeftShift}, u...)}
+		for _, c := range strconv.FormatInt(int64(r), 16) + " " {
+			codes, ok := m.codes(c)
+			if !ok {
+				seq = nil
+				break
+			}
+			seq = append(seq, codes)
+		}
+		if seq == nil {
+			log.Printf("input: can't type %q", r)
+			continue
+		}
+		strokes = append(strokes, seq...)
+	}
+	return strokes
+}
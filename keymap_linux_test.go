@@ -0,0 +1,170 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+// germanKeymap is an excerpt of xkbcomp -xkb output for a German layout.
+const germanKeymap = `xkb_keymap {
+xkb_keycodes "evdev+aliases(qwertz)" {
+    minimum = 8;
+    maximum = 255;
+    <AE01> = 10;
+    <AE02> = 11;
+    <AE03> = 12;
+    <AE07> = 16;
+    <AD01> = 24;
+    <AD03> = 26;
+    <AD06> = 29;
+    <AD07> = 30;
+    <AC11> = 48;
+    <AB01> = 52;
+    <SPCE> = 65;
+    <KP7> = 79;
+    <RALT> = 108;
+    <LVL3> = 92;
+    <LFSH> = 50;
+    alias <ALGR> = <RALT>;
+    indicator 1 = "Caps Lock";
+};
+xkb_types "complete" {
+    type "TWO_LEVEL" {
+        modifiers= Shift;
+        map[Shift]= 2;
+    };
+};
+xkb_compatibility "complete" {
+    interpret ISO_Level3_Shift+AnyOf(all) {
+        action= SetMods(modifiers=LevelThree,clearLocks);
+    };
+};
+xkb_symbols "pc+de+inet(evdev)" {
+    name[group1]="German";
+    key <AE01> {         [               1,          exclam,     onesuperior,      exclamdown ] };
+    key <AE02> {         [               2,        quotedbl,     twosuperior,       oneeighth ] };
+    key <AE03> {         [               3,         section,   threesuperior,        sterling ] };
+    key <AE07> {         [               7,           slash,       braceleft,    seveneighths ] };
+    key <AD01> {
+        type= "FOUR_LEVEL_SEMIALPHABETIC",
+        symbols[Group1]= [               q,               Q,              at,     Greek_OMEGA ]
+    };
+    key <AD03> {
+        type= "FOUR_LEVEL_SEMIALPHABETIC",
+        symbols[Group1]= [               e,               E,        EuroSign,        EuroSign ]
+    };
+    key <AD06> {
+        type= "FOUR_LEVEL_SEMIALPHABETIC",
+        symbols[Group1]= [               z,               Z,       leftarrow,             yen ]
+    };
+    key <AD07> {
+        type= "FOUR_LEVEL_SEMIALPHABETIC",
+        symbols[Group1]= [               u,               U,       downarrow,         uparrow ]
+    };
+    key <AC11> {
+        type= "FOUR_LEVEL_ALPHABETIC",
+        symbols[Group1]= [      adiaeresis,      Adiaeresis, dead_circumflex,      dead_caron ]
+    };
+    key <AB01> {
+        type= "FOUR_LEVEL_SEMIALPHABETIC",
+        symbols[Group1]= [               y,               Y,         guillemotright,             U203A ]
+    };
+    key <SPCE> {         [           space ] };
+    key <KP7> {
+        type= "KEYPAD",
+        symbols[Group1]= [         KP_Home,               7 ]
+    };
+    key <LVL3> {         [ ISO_Level3_Shift ] };
+    key <RALT> {
+        type= "ONE_LEVEL",
+        symbols[Group1]= [ ISO_Level3_Shift ]
+    };
+    key <LFSH> {         [         Shift_L ] };
+    modifier_map Shift { <LFSH> };
+};
+xkb_geometry "pc(pc105)" {
+    key.gap= 1;
+    row {
+        keys { <AE01>, <AE02> };
+    };
+};
+};
+`
+
+func TestParseKeymap(t *testing.T) {
+	km, err := parseKeymap(germanKeymap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if km.altGr != evKeyRightAlt {
+		t.Errorf("altGr = %d, want %d", km.altGr, evKeyRightAlt)
+	}
+	for _, tt := range []struct {
+		r    rune
+		want string
+	}{
+		{'z', "[21]"},
+		{'y', "[44]"},
+		{'Y', "[42 44]"},
+		{'"', "[42 3]"},
+		{'@', "[100 16]"},
+		{'{', "[100 8]"},
+		{'€', "[100 18]"},
+		{'ä', "[40]"},
+		{'›', "[42 100 44]"},
+		{' ', "[57]"},
+		{'\n', "[28]"},
+		{'7', "[8]"},
+	} {
+		codes, ok := km.codes(tt.r)
+		if got := fmt.Sprint(codes); !ok || got != tt.want {
+			t.Errorf("codes(%q) = %s, %v, want %s", tt.r, got, ok, tt.want)
+		}
+	}
+	if codes, ok := km.codes('^'); ok {
+		t.Errorf("codes('^') = %v, want none for a dead key", codes)
+	}
+}
+
+func TestKeymapStrokes(t *testing.T) {
+	km, err := parseKeymap(germanKeymap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// ✓ is missing and composed from Ctrl+Shift+U, 2713 and space, all
+	// typed on the German keys.
+	got := fmt.Sprint(km.strokes("z✓", func() bool { return true }))
+	want := "[[21] [29 42 22] [3] [8] [2] [4] [57]]"
+	if got != want {
+		t.Errorf("strokes = %s, want %s", got, want)
+	}
+
+	// Without IBus it is left out.
+	got = fmt.Sprint(km.strokes("z✓", func() bool { return false }))
+	if want := "[[21]]"; got != want {
+		t.Errorf("strokes without compose = %s, want %s", got, want)
+	}
+}
+
+func TestKeysymRune(t *testing.T) {
+	for name, want := range map[string]rune{
+		"a":           'a',
+		"at":          '@',
+		"adiaeresis":  'ä',
+		"Cyrillic_ya": 'я',
+		"EuroSign":    '€',
+		"U2713":       '✓',
+		"0x1002713":   '✓',
+	} {
+		if r, ok := keysymRune(name); !ok || r != want {
+			t.Errorf("keysymRune(%q) = %q, %v, want %q", name, r, ok, want)
+		}
+	}
+	for _, name := range []string{"dead_acute", "Shift_L", "NoSymbol", "0x20"} {
+		if r, ok := keysymRune(name); ok {
+			t.Errorf("keysymRune(%q) = %q, want none", name, r)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+//go:build linux
+
+package main
+
+// keysymRunes are the characters of the Latin, Greek and Cyrillic keysyms
+// by name, from X11/keysymdef.h. Single character names, e.g. "a", stand
+// for themselves and are left out.
+var keysymRunes = map[string]rune{
+	"space": ' ', "exclam": '!', "quotedbl": '"', "numbersign": '#',
+	"dollar": '$', "percent": '%', "ampersand": '&', "apostrophe": '\'',
+	"parenleft": '(', "parenright": ')', "asterisk": '*', "plus": '+',
+	"comma": ',', "minus": '-', "period": '.', "slash": '/', "colon": ':',
+	"semicolon": ';', "less": '<', "equal": '=', "greater": '>',
+	"question": '?', "at": '@', "bracketleft": '[', "backslash": '\\',
+	"bracketright": ']', "asciicircum": '^', "underscore": '_', "grave": '`',
+	"braceleft": '{', "bar": '|', "braceright": '}', "asciitilde": '~',
+	"nobreakspace": '\u00a0', "exclamdown": '¡', "cent": '¢', "sterling": '£',
+	"currency": '¤', "yen": '¥', "brokenbar": '¦', "section": '§',
+	"diaeresis": '¨', "copyright": '©', "ordfeminine": 'ª',
+	"guillemotleft": '«', "notsign": '¬', "hyphen": '\u00ad', "registered": '®',
+	"macron": '¯', "degree": '°', "plusminus": '±', "twosuperior": '²',
+	"threesuperior": '³', "acute": '´', "mu": 'µ', "paragraph": '¶',
+	"periodcentered": '·', "cedilla": '¸', "onesuperior": '¹', "masculine": 'º',
+	"guillemotright": '»', "onequarter": '¼', "onehalf": '½',
+	"threequarters": '¾', "questiondown": '¿', "Agrave": 'À', "Aacute": 'Á',
+	"Acircumflex": 'Â', "Atilde": 'Ã', "Adiaeresis": 'Ä', "Aring": 'Å',
+	"AE": 'Æ', "Ccedilla": 'Ç', "Egrave": 'È', "Eacute": 'É',
+	"Ecircumflex": 'Ê', "Ediaeresis": 'Ë', "Igrave": 'Ì', "Iacute": 'Í',
+	"Icircumflex": 'Î', "Idiaeresis": 'Ï', "ETH": 'Ð', "Ntilde": 'Ñ',
+	"Ograve": 'Ò', "Oacute": 'Ó', "Ocircumflex": 'Ô', "Otilde": 'Õ',
+	"Odiaeresis": 'Ö', "multiply": '×', "Oslash": 'Ø', "Ooblique": 'Ø',
+	"Ugrave": 'Ù', "Uacute": 'Ú', "Ucircumflex": 'Û', "Udiaeresis": 'Ü',
+	"Yacute": 'Ý', "THORN": 'Þ', "ssharp": 'ß', "agrave": 'à', "aacute": 'á',
+	"acircumflex": 'â', "atilde": 'ã', "adiaeresis": 'ä', "aring": 'å',
+	"ae": 'æ', "ccedilla": 'ç', "egrave": 'è', "eacute": 'é',
+	"ecircumflex": 'ê', "ediaeresis": 'ë', "igrave": 'ì', "iacute": 'í',
+	"icircumflex": 'î', "idiaeresis": 'ï', "eth": 'ð', "ntilde": 'ñ',
+	"ograve": 'ò', "oacute": 'ó', "ocircumflex": 'ô', "otilde": 'õ',
+	"odiaeresis": 'ö', "division": '÷', "oslash": 'ø', "ooblique": 'ø',
+	"ugrave": 'ù', "uacute": 'ú', "ucircumflex": 'û', "udiaeresis": 'ü',
+	"yacute": 'ý', "thorn": 'þ', "ydiaeresis": 'ÿ', "Aogonek": 'Ą',
+	"breve": '˘', "Lstroke": 'Ł', "Lcaron": 'Ľ', "Sacute": 'Ś', "Scaron": 'Š',
+	"Scedilla": 'Ş', "Tcaron": 'Ť', "Zacute": 'Ź', "Zcaron": 'Ž',
+	"Zabovedot": 'Ż', "aogonek": 'ą', "ogonek": '˛', "lstroke": 'ł',
+	"lcaron": 'ľ', "sacute": 'ś', "caron": 'ˇ', "scaron": 'š', "scedilla": 'ş',
+	"tcaron": 'ť', "zacute": 'ź', "doubleacute": '˝', "zcaron": 'ž',
+	"zabovedot": 'ż', "Racute": 'Ŕ', "Abreve": 'Ă', "Lacute": 'Ĺ',
+	"Cacute": 'Ć', "Ccaron": 'Č', "Eogonek": 'Ę', "Ecaron": 'Ě', "Dcaron": 'Ď',
+	"Dstroke": 'Đ', "Nacute": 'Ń', "Ncaron": 'Ň', "Odoubleacute": 'Ő',
+	"Rcaron": 'Ř', "Uring": 'Ů', "Udoubleacute": 'Ű', "Tcedilla": 'Ţ',
+	"racute": 'ŕ', "abreve": 'ă', "lacute": 'ĺ', "cacute": 'ć', "ccaron": 'č',
+	"eogonek": 'ę', "ecaron": 'ě', "dcaron": 'ď', "dstroke": 'đ', "nacute": 'ń',
+	"ncaron": 'ň', "odoubleacute": 'ő', "rcaron": 'ř', "uring": 'ů',
+	"udoubleacute": 'ű', "tcedilla": 'ţ', "abovedot": '˙', "Hstroke": 'Ħ',
+	"Hcircumflex": 'Ĥ', "Iabovedot": 'İ', "Gbreve": 'Ğ', "Jcircumflex": 'Ĵ',
+	"hstroke": 'ħ', "hcircumflex": 'ĥ', "idotless": 'ı', "gbreve": 'ğ',
+	"jcircumflex": 'ĵ', "Cabovedot": 'Ċ', "Ccircumflex": 'Ĉ', "Gabovedot": 'Ġ',
+	"Gcircumflex": 'Ĝ', "Ubreve": 'Ŭ', "Scircumflex": 'Ŝ', "cabovedot": 'ċ',
+	"ccircumflex": 'ĉ', "gabovedot": 'ġ', "gcircumflex": 'ĝ', "ubreve": 'ŭ',
+	"scircumflex": 'ŝ', "kra": 'ĸ', "Rcedilla": 'Ŗ', "Itilde": 'Ĩ',
+	"Lcedilla": 'Ļ', "Emacron": 'Ē', "Gcedilla": 'Ģ', "Tslash": 'Ŧ',
+	"rcedilla": 'ŗ', "itilde": 'ĩ', "lcedilla": 'ļ', "emacron": 'ē',
+	"gcedilla": 'ģ', "tslash": 'ŧ', "ENG": 'Ŋ', "eng": 'ŋ', "Amacron": 'Ā',
+	"Iogonek": 'Į', "Eabovedot": 'Ė', "Imacron": 'Ī', "Ncedilla": 'Ņ',
+	"Omacron": 'Ō', "Kcedilla": 'Ķ', "Uogonek": 'Ų', "Utilde": 'Ũ',
+	"Umacron": 'Ū', "amacron": 'ā', "iogonek": 'į', "eabovedot": 'ė',
+	"imacron": 'ī', "ncedilla": 'ņ', "omacron": 'ō', "kcedilla": 'ķ',
+	"uogonek": 'ų', "utilde": 'ũ', "umacron": 'ū', "OE": 'Œ', "oe": 'œ',
+	"Ydiaeresis": 'Ÿ', "Serbian_dje": 'ђ', "Macedonia_gje": 'ѓ',
+	"Cyrillic_io": 'ё', "Ukrainian_ie": 'є', "Macedonia_dse": 'ѕ',
+	"Ukrainian_i": 'і', "Ukrainian_yi": 'ї', "Cyrillic_je": 'ј',
+	"Cyrillic_lje": 'љ', "Cyrillic_nje": 'њ', "Serbian_tshe": 'ћ',
+	"Macedonia_kje": 'ќ', "Ukrainian_ghe_with_upturn": 'ґ',
+	"Byelorussian_shortu": 'ў', "Cyrillic_dzhe": 'џ', "numerosign": '№',
+	"Serbian_DJE": 'Ђ', "Macedonia_GJE": 'Ѓ', "Cyrillic_IO": 'Ё',
+	"Ukrainian_IE": 'Є', "Macedonia_DSE": 'Ѕ', "Ukrainian_I": 'І',
+	"Ukrainian_YI": 'Ї', "Cyrillic_JE": 'Ј', "Cyrillic_LJE": 'Љ',
+	"Cyrillic_NJE": 'Њ', "Serbian_TSHE": 'Ћ', "Macedonia_KJE": 'Ќ',
+	"Ukrainian_GHE_WITH_UPTURN": 'Ґ', "Byelorussian_SHORTU": 'Ў',
+	"Cyrillic_DZHE": 'Џ', "Cyrillic_yu": 'ю', "Cyrillic_a": 'а',
+	"Cyrillic_be": 'б', "Cyrillic_tse": 'ц', "Cyrillic_de": 'д',
+	"Cyrillic_ie": 'е', "Cyrillic_ef": 'ф', "Cyrillic_ghe": 'г',
+	"Cyrillic_ha": 'х', "Cyrillic_i": 'и', "Cyrillic_shorti": 'й',
+	"Cyrillic_ka": 'к', "Cyrillic_el": 'л', "Cyrillic_em": 'м',
+	"Cyrillic_en": 'н', "Cyrillic_o": 'о', "Cyrillic_pe": 'п',
+	"Cyrillic_ya": 'я', "Cyrillic_er": 'р', "Cyrillic_es": 'с',
+	"Cyrillic_te": 'т', "Cyrillic_u": 'у', "Cyrillic_zhe": 'ж',
+	"Cyrillic_ve": 'в', "Cyrillic_softsign": 'ь', "Cyrillic_yeru": 'ы',
+	"Cyrillic_ze": 'з', "Cyrillic_sha": 'ш', "Cyrillic_e": 'э',
+	"Cyrillic_shcha": 'щ', "Cyrillic_che": 'ч', "Cyrillic_hardsign": 'ъ',
+	"Cyrillic_YU": 'Ю', "Cyrillic_A": 'А', "Cyrillic_BE": 'Б',
+	"Cyrillic_TSE": 'Ц', "Cyrillic_DE": 'Д', "Cyrillic_IE": 'Е',
+	"Cyrillic_EF": 'Ф', "Cyrillic_GHE": 'Г', "Cyrillic_HA": 'Х',
+	"Cyrillic_I": 'И', "Cyrillic_SHORTI": 'Й', "Cyrillic_KA": 'К',
+	"Cyrillic_EL": 'Л', "Cyrillic_EM": 'М', "Cyrillic_EN": 'Н',
+	"Cyrillic_O": 'О', "Cyrillic_PE": 'П', "Cyrillic_YA": 'Я',
+	"Cyrillic_ER": 'Р', "Cyrillic_ES": 'С', "Cyrillic_TE": 'Т',
+	"Cyrillic_U": 'У', "Cyrillic_ZHE": 'Ж', "Cyrillic_VE": 'В',
+	"Cyrillic_SOFTSIGN": 'Ь', "Cyrillic_YERU": 'Ы', "Cyrillic_ZE": 'З',
+	"Cyrillic_SHA": 'Ш', "Cyrillic_E": 'Э', "Cyrillic_SHCHA": 'Щ',
+	"Cyrillic_CHE": 'Ч', "Cyrillic_HARDSIGN": 'Ъ', "Greek_ALPHAaccent": 'Ά',
+	"Greek_EPSILONaccent": 'Έ', "Greek_ETAaccent": 'Ή', "Greek_IOTAaccent": 'Ί',
+	"Greek_IOTAdieresis": 'Ϊ', "Greek_OMICRONaccent": 'Ό',
+	"Greek_UPSILONaccent": 'Ύ', "Greek_UPSILONdieresis": 'Ϋ',
+	"Greek_OMEGAaccent": 'Ώ', "Greek_accentdieresis": '΅',
+	"Greek_horizbar": '―', "Greek_alphaaccent": 'ά', "Greek_epsilonaccent": 'έ',
+	"Greek_etaaccent": 'ή', "Greek_iotaaccent": 'ί', "Greek_iotadieresis": 'ϊ',
+	"Greek_iotaaccentdieresis": 'ΐ', "Greek_omicronaccent": 'ό',
+	"Greek_upsilonaccent": 'ύ', "Greek_upsilondieresis": 'ϋ',
+	"Greek_upsilonaccentdieresis": 'ΰ', "Greek_omegaaccent": 'ώ',
+	"Greek_ALPHA": 'Α', "Greek_BETA": 'Β', "Greek_GAMMA": 'Γ',
+	"Greek_DELTA": 'Δ', "Greek_EPSILON": 'Ε', "Greek_ZETA": 'Ζ',
+	"Greek_ETA": 'Η', "Greek_THETA": 'Θ', "Greek_IOTA": 'Ι', "Greek_KAPPA": 'Κ',
+	"Greek_LAMDA": 'Λ', "Greek_LAMBDA": 'Λ', "Greek_MU": 'Μ', "Greek_NU": 'Ν',
+	"Greek_XI": 'Ξ', "Greek_OMICRON": 'Ο', "Greek_PI": 'Π', "Greek_RHO": 'Ρ',
+	"Greek_SIGMA": 'Σ', "Greek_TAU": 'Τ', "Greek_UPSILON": 'Υ',
+	"Greek_PHI": 'Φ', "Greek_CHI": 'Χ', "Greek_PSI": 'Ψ', "Greek_OMEGA": 'Ω',
+	"Greek_alpha": 'α', "Greek_beta": 'β', "Greek_gamma": 'γ',
+	"Greek_delta": 'δ', "Greek_epsilon": 'ε', "Greek_zeta": 'ζ',
+	"Greek_eta": 'η', "Greek_theta": 'θ', "Greek_iota": 'ι', "Greek_kappa": 'κ',
+	"Greek_lamda": 'λ', "Greek_lambda": 'λ', "Greek_mu": 'μ', "Greek_nu": 'ν',
+	"Greek_xi": 'ξ', "Greek_omicron": 'ο', "Greek_pi": 'π', "Greek_rho": 'ρ',
+	"Greek_sigma": 'σ', "Greek_finalsmallsigma": 'ς', "Greek_tau": 'τ',
+	"Greek_upsilon": 'υ', "Greek_phi": 'φ', "Greek_chi": 'χ', "Greek_psi": 'ψ',
+	"Greek_omega": 'ω', "EuroSign": '€',
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"log"
 	"net"
+	"sync"
 	"time"
 )
 
@@ -16,13 +17,34 @@ type Client struct {
 	cancel          context.CancelFunc
 	conn            net.Conn
 	opts            dialOptions
+	layout          Layout
 	serverKeepalive chan struct{}
-	recvBuf         chan Message
+	recvBuf         chan recvResult
+
+	mu    sync.Mutex
+	state State
+	err   error // Why the client closed itself.
+}
+
+// recvResult is a received message, or the reason it was rejected.
+type recvResult struct {
+	m   Message
+	err error
 }
 
 type dialOptions struct {
 	updateFrequency int
 	filters         []string
+	network         string
+	localAddr       string
+	localPort       int
+	iface           string
+	stateFunc       func(State, error)
+
+	// Keepalive timing, see the protocol constants.
+	keepaliveInterval time.Duration
+	staleTimeout      time.Duration
+	serverTimeout     time.Duration
 }
 
 // DialOption sets options for dial.
@@ -42,21 +64,121 @@ func WithFilters(filters ...string) func(*dialOptions) {
 	}
 }
 
+// WithLocalPort sets the local UDP port the client sends from, 0 picks an
+// ephemeral port. The default is DefaultLocalPort.
+func WithLocalPort(port int) func(*dialOptions) {
+	return func(o *dialOptions) {
+		o.localPort = port
+	}
+}
+
+// WithLocalAddr sets the local IP address the client sends from.
+func WithLocalAddr(ip string) func(*dialOptions) {
+	return func(o *dialOptions) {
+		o.localAddr = ip
+	}
+}
+
+// WithInterface sends from an address of the named network interface.
+func WithInterface(name string) func(*dialOptions) {
+	return func(o *dialOptions) {
+		o.iface = name
+	}
+}
+
+// WithNetwork selects the IP version: "udp4" (default), "udp6" or "udp"
+// for either.
+func WithNetwork(network string) func(*dialOptions) {
+	return func(o *dialOptions) {
+		o.network = network
+	}
+}
+
+// localUDPAddr returns the address to send from.
+func (o dialOptions) localUDPAddr() (*net.UDPAddr, error) {
+	addr := &net.UDPAddr{Port: o.localPort}
+	if o.localAddr != "" {
+		addr.IP = net.ParseIP(o.localAddr)
+		if addr.IP == nil {
+			return nil, fmt.Errorf("invalid local address %q", o.localAddr)
+		}
+		if !matchNetwork(o.network, addr.IP) {
+			return nil, fmt.Errorf("local address %s is not %s", addr.IP, o.network)
+		}
+		return addr, nil
+	}
+	if o.iface == "" {
+		return addr, nil
+	}
+
+	ifi, err := net.InterfaceByName(o.iface)
+	if err != nil {
+		return nil, err
+	}
+	addrs, err := ifi.Addrs()
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range addrs {
+		ipnet, ok := a.(*net.IPNet)
+		if !ok || !matchNetwork(o.network, ipnet.IP) {
+			continue
+		}
+		addr.IP = ipnet.IP
+		if ipnet.IP.IsLinkLocalUnicast() && ipnet.IP.To4() == nil {
+			addr.Zone = ifi.Name
+		}
+		return addr, nil
+	}
+	return nil, fmt.Errorf("interface %s has no %s address", o.iface, o.network)
+}
+
+// matchNetwork reports whether ip can be used on network.
+func matchNetwork(network string, ip net.IP) bool {
+	switch network {
+	case "udp4":
+		return ip.To4() != nil
+	case "udp6":
+		return ip.To4() == nil
+	}
+	return true
+}
+
 // Dial connects to a magic4pc server running in webOS.
 func Dial(ctx context.Context, addr string, opts ...DialOption) (*Client, error) {
 	o := dialOptions{
-		updateFrequency: 250,
+		updateFrequency: DefaultUpdateFrequency,
 		filters:         DefaultFilters,
+		network:         "udp4",
+		localPort:       DefaultLocalPort,
+
+		keepaliveInterval: clientKeepaliveInterval,
+		staleTimeout:      serverStaleTimeout,
+		serverTimeout:     serverKeepaliveTimeout,
 	}
 	for _, opt := range opts {
 		opt(&o)
 	}
+	switch o.network {
+	case "udp", "udp4", "udp6":
+	default:
+		return nil, fmt.Errorf("unknown network %q", o.network)
+	}
+	laddr, err := o.localUDPAddr()
+	if err != nil {
+		return nil, err
+	}
+
+	layout, err := NewLayout(o.filters)
+	if err != nil {
+		return nil, err
+	}
 
 	d := &net.Dialer{
-		Timeout: 5 * time.Second,
-		LocalAddr: &net.UDPAddr{Port: 9106},
+		Timeout:   5 * time.Second,
+		LocalAddr: laddr,
 	}
-	conn, err := d.DialContext(ctx, "udp4", addr)
+	conn, err := d.DialContext(ctx, o.network, addr)
 	if err != nil {
 		return nil, err
 	}
@@ -67,8 +189,9 @@ func Dial(ctx context.Context, addr string, opts ...DialOption) (*Client, error)
 		cancel:          cancel,
 		conn:            conn,
 		opts:            o,
+		layout:          layout,
 		serverKeepalive: make(chan struct{}, 1),
-		recvBuf:         make(chan Message, 10), // Buffer up to 10 messages after which we discard them.
+		recvBuf:         make(chan recvResult, 10), // Buffer up to 10 messages after which we discard them.
 	}
 
 	// Register our client with the server.
@@ -83,6 +206,7 @@ func Dial(ctx context.Context, addr string, opts ...DialOption) (*Client, error)
 		c.Close()
 		return nil, fmt.Errorf("register failed: %w", err)
 	}
+	c.setState(StateRegistering, nil)
 
 	// Tell the server that we're alive and well.
 	go c.keepalive()
@@ -104,10 +228,10 @@ recvLoop:
 		n, err := c.conn.Read(buf[:])
 		if err != nil {
 			if errors.Is(err, net.ErrClosed) {
-				log.Printf("m4p: Client: recv: connection closed: %v", err)
+				debugf("m4p: Client: recv: connection closed: %v", err)
 				return
 			}
-			log.Printf("m4p: Client: recv: read udp packet failed: %v", err)
+			debugf("m4p: Client: recv: read udp packet failed: %v", err)
 			continue
 		}
 
@@ -116,37 +240,46 @@ recvLoop:
 			log.Printf("m4p: Client: recv: decode failed: %v", err)
 			continue
 		}
+		res := recvResult{m: m}
+
+		// Any message shows the server is alive, non-blocking (chan is buffered).
+		select {
+		case c.serverKeepalive <- struct{}{}:
+		default:
+		}
 
 		switch m.Type {
 		case KeepAliveMessage:
 			// log.Printf("m4p: Client: recv: got %s", m.Type)
-
-			// Trigger server keepalive, non-blocking (chan is buffered).
-			select {
-			case c.serverKeepalive <- struct{}{}:
-			default:
-			}
-
 			goto recvLoop
 
 		case InputMessage:
-			log.Printf("m4p: Client: recv: got %s: %v", m.Type, m.Input)
+			debugf("m4p: Client: recv: got %s: %v", m.Type, m.Input)
 
 		case MouseMessage:
-			log.Printf("m4p: Client: recv: got %s: %v", m.Type, m.Mouse)
+			debugf("m4p: Client: recv: got %s: %v", m.Type, m.Mouse)
 
 		case WheelMessage:
-			log.Printf("m4p: Client: recv: got %s: %v", m.Type, m.Wheel)
+			debugf("m4p: Client: recv: got %s: %v", m.Type, m.Wheel)
 
 		case RemoteUpdateMessage:
 			// log.Printf("m4p: Client: recv: got %s: %s", m.Type, hex.EncodeToString(m.RemoteUpdate.Payload))
+			if m.RemoteUpdate == nil {
+				m.RemoteUpdate = &RemoteUpdate{}
+				res.m = m
+			}
+			m.RemoteUpdate.Layout = &c.layout
+			if n := len(m.RemoteUpdate.Payload); n != c.layout.Size() {
+				res.err = &PayloadLengthError{Filters: c.layout.Filters(), Want: c.layout.Size(), Got: n}
+				res.m = Message{}
+			}
 
 		default:
 			log.Printf("m4p: Client: recv: unknown message: %s", m.Type)
 		}
 
 		select {
-		case c.recvBuf <- m:
+		case c.recvBuf <- res:
 		default:
 			log.Printf("m4p: Client: recv: buffer full, discarding message: %s", m.Type)
 		}
@@ -154,32 +287,35 @@ recvLoop:
 }
 
 func (c *Client) keepalive() {
-	defer c.Close()
-
-	clientKeepalive := time.NewTicker(clientKeepaliveInterval)
+	clientKeepalive := time.NewTicker(c.opts.keepaliveInterval)
 	defer clientKeepalive.Stop()
 
 	// If we don't hear from the server for serverKeepaliveTimeout, reconnect.
-	serverTimeout := time.NewTimer(serverKeepaliveTimeout)
+	serverTimeout := time.NewTimer(c.opts.serverTimeout)
 	defer serverTimeout.Stop()
+	serverStale := time.NewTimer(c.opts.staleTimeout)
+	defer serverStale.Stop()
 
 	for {
 		select {
 		case <-c.ctx.Done():
+			c.closeWith(nil)
 			return
 
 		case <-c.serverKeepalive:
 			// server is alive — reset timeout
-			if !serverTimeout.Stop() {
-				select {
-				case <-serverTimeout.C:
-				default:
-				}
+			resetTimer(serverTimeout, c.opts.serverTimeout)
+			resetTimer(serverStale, c.opts.staleTimeout)
+			c.setState(StateConnected, nil)
+
+		case <-serverStale.C:
+			if c.State() == StateConnected {
+				c.setState(StateStale, nil)
 			}
-			serverTimeout.Reset(serverKeepaliveTimeout)
 
 		case <-serverTimeout.C:
-			log.Printf("m4p: Client: keepalive: server silent for %v, disconnecting...", serverKeepaliveTimeout)
+			debugf("m4p: Client: keepalive: server silent for %v, disconnecting...", c.opts.serverTimeout)
+			c.closeWith(ErrServerTimeout)
 			return
 
 		case <-clientKeepalive.C:
@@ -187,15 +323,61 @@ func (c *Client) keepalive() {
 			if err != nil {
 				if errors.Is(err, net.ErrClosed) {
 					log.Printf("m4p: Client: keepalive: connection closed: %v", err)
+					c.closeWith(nil)
 					return
 				}
 				log.Printf("m4p: Client: keepalive: send client keepalive failed, disconnecting...")
+				c.closeWith(fmt.Errorf("send keepalive: %w", err))
 				return
 			}
 		}
 	}
 }
 
+// resetTimer restarts t, which may have fired already.
+func resetTimer(t *time.Timer, d time.Duration) {
+	if !t.Stop() {
+		select {
+		case <-t.C:
+		default:
+		}
+	}
+	t.Reset(d)
+}
+
+// State returns the connection state.
+func (c *Client) State() State {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.state
+}
+
+func (c *Client) setState(s State, err error) {
+	c.mu.Lock()
+	if c.state == s || c.state == StateDisconnected && s != StateRegistering {
+		c.mu.Unlock()
+		return
+	}
+	c.state = s
+	f := c.opts.stateFunc
+	c.mu.Unlock()
+	if f != nil {
+		f(s, err)
+	}
+}
+
+// closeWith closes the client, recording err as the reason.
+func (c *Client) closeWith(err error) {
+	c.mu.Lock()
+	if c.err == nil {
+		c.err = err
+	}
+	c.mu.Unlock()
+	c.cancel()
+	c.conn.Close()
+	c.setState(StateDisconnected, err)
+}
+
 // Send a message to the magic4pc server.
 func (c *Client) Send(m Message) error {
 	b, err := json.Marshal(m)
@@ -210,19 +392,35 @@ func (c *Client) Send(m Message) error {
 
 // Recv messages from the magic4pc server. Keepalives are handled
 // transparently by the client and are not observable.
+//
+// RemoteUpdate messages carry the negotiated Layout. A RemoteUpdate whose
+// payload does not match it is rejected with a *PayloadLengthError, the
+// client remains usable.
 func (c *Client) Recv(ctx context.Context) (Message, error) {
 	select {
 	case <-ctx.Done():
 		return Message{}, ctx.Err()
 	case <-c.ctx.Done():
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if c.err != nil {
+			return Message{}, c.err
+		}
 		return Message{}, c.ctx.Err()
-	case m := <-c.recvBuf:
-		return m, nil
+	case res := <-c.recvBuf:
+		return res.m, res.err
 	}
 }
 
+// Layout returns the RemoteUpdate payload layout negotiated in Dial.
+func (c *Client) Layout() Layout {
+	return c.layout
+}
+
 // Close the client and connection.
 func (c *Client) Close() error {
 	c.cancel()
-	return c.conn.Close()
+	err := c.conn.Close()
+	c.setState(StateDisconnected, nil)
+	return err
 }
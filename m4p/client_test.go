@@ -0,0 +1,318 @@
+package m4p_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/netham45/magic4pc_altclient/m4p"
+	"github.com/netham45/magic4pc_altclient/m4p/m4ptest"
+)
+
+const testTimeout = 2 * time.Second
+
+// stateChange is a state reported through WithStateFunc.
+type stateChange struct {
+	state m4p.State
+	err   error
+}
+
+func newServer(t *testing.T, opts ...m4ptest.Option) *m4ptest.Server {
+	t.Helper()
+	srv, err := m4ptest.NewServer(append([]m4ptest.Option{m4ptest.WithKeepaliveInterval(20 * time.Millisecond)}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { srv.Close() })
+	return srv
+}
+
+// dial connects to srv from a free port, with keepalives every 20ms, stale
+// after 100ms and giving up on the server after 300ms of silence, and waits
+// for the registration. State changes of the client are sent to the
+// returned channel.
+func dial(t *testing.T, srv *m4ptest.Server, opts ...m4p.DialOption) (*m4p.Client, m4p.Register, <-chan stateChange) {
+	t.Helper()
+	states := make(chan stateChange, 64)
+	opts = append([]m4p.DialOption{
+		m4p.WithLocalPort(0),
+		m4p.WithKeepaliveTiming(20*time.Millisecond, 100*time.Millisecond, 300*time.Millisecond),
+		m4p.WithStateFunc(func(s m4p.State, err error) {
+			select {
+			case states <- stateChange{s, err}:
+			default:
+			}
+		}),
+	}, opts...)
+
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	c, err := m4p.Dial(ctx, srv.Addr(), opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	reg, err := srv.WaitRegistered(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, reg, states
+}
+
+// waitState waits for the client to report want, failing on any error
+// reported along the way other than wantErr.
+func waitState(t *testing.T, states <-chan stateChange, want m4p.State, wantErr error) {
+	t.Helper()
+	timeout := time.After(testTimeout)
+	for {
+		select {
+		case <-timeout:
+			t.Fatalf("timed out waiting for state %v", want)
+		case sc := <-states:
+			if sc.state != want {
+				continue
+			}
+			if !errors.Is(sc.err, wantErr) {
+				t.Fatalf("state %v with error %v, want %v", sc.state, sc.err, wantErr)
+			}
+			return
+		}
+	}
+}
+
+func recv(t *testing.T, c *m4p.Client) (m4p.Message, error) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+	defer cancel()
+	return c.Recv(ctx)
+}
+
+func TestClientRegister(t *testing.T) {
+	srv := newServer(t)
+	c, reg, states := dial(t, srv,
+		m4p.WithUpdateFrequency(100),
+		m4p.WithFilters(m4p.FilterCoordinate, m4p.FilterQuaternion))
+
+	if reg.UpdateFrequency != 100 {
+		t.Errorf("registered with update frequency %d, want 100", reg.UpdateFrequency)
+	}
+	if len(reg.Filter) != 2 || reg.Filter[0] != m4p.FilterCoordinate || reg.Filter[1] != m4p.FilterQuaternion {
+		t.Errorf("registered with filters %v", reg.Filter)
+	}
+	if got := c.Layout().Size(); got != 24 {
+		t.Errorf("Layout().Size() = %d, want 24", got)
+	}
+
+	waitState(t, states, m4p.StateRegistering, nil)
+	waitState(t, states, m4p.StateConnected, nil)
+
+	deadline := time.Now().Add(testTimeout)
+	for srv.ClientKeepalives() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("server got no keepalive from the client")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestClientRecv(t *testing.T) {
+	srv := newServer(t)
+	c, _, _ := dial(t, srv)
+
+	if err := srv.SendInput(m4p.KeyBack, true); err != nil {
+		t.Fatal(err)
+	}
+	m, err := recv(t, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Type != m4p.InputMessage || m.Input.Parameters.KeyCode != m4p.KeyBack || !m.Input.Parameters.IsDown {
+		t.Errorf("got %s %+v, want input %d down", m.Type, m.Input, m4p.KeyBack)
+	}
+
+	if err := srv.SendMouse("mousedown", 10, 20); err != nil {
+		t.Fatal(err)
+	}
+	if m, err = recv(t, c); err != nil {
+		t.Fatal(err)
+	}
+	if m.Type != m4p.MouseMessage || m.Mouse.Type != "mousedown" || m.Mouse.X != 10 || m.Mouse.Y != 20 {
+		t.Errorf("got %s %+v, want mousedown at 10,20", m.Type, m.Mouse)
+	}
+
+	if err := srv.SendWheel(-120, 30, 40); err != nil {
+		t.Fatal(err)
+	}
+	if m, err = recv(t, c); err != nil {
+		t.Fatal(err)
+	}
+	if m.Type != m4p.WheelMessage || m.Wheel.Delta != -120 {
+		t.Errorf("got %s %+v, want wheel -120", m.Type, m.Wheel)
+	}
+
+	if err := srv.SendRemoteUpdate(testFrame); err != nil {
+		t.Fatal(err)
+	}
+	if m, err = recv(t, c); err != nil {
+		t.Fatal(err)
+	}
+	if m.Type != m4p.RemoteUpdateMessage {
+		t.Fatalf("got %s, want %s", m.Type, m4p.RemoteUpdateMessage)
+	}
+	f, err := m.RemoteUpdate.Frame()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Coordinate != testFrame.Coordinate || f.Gyroscope != testFrame.Gyroscope || f.Quaternion != testFrame.Quaternion {
+		t.Errorf("got frame %+v, want %+v", f, testFrame)
+	}
+}
+
+func TestClientPayloadLength(t *testing.T) {
+	srv := newServer(t)
+	c, _, _ := dial(t, srv)
+
+	if err := srv.SendPayload(make([]byte, 10)); err != nil {
+		t.Fatal(err)
+	}
+	_, err := recv(t, c)
+	var lenErr *m4p.PayloadLengthError
+	if !errors.As(err, &lenErr) {
+		t.Fatalf("Recv() = %v, want PayloadLengthError", err)
+	}
+	if lenErr.Got != 10 || lenErr.Want != c.Layout().Size() {
+		t.Errorf("got %d bytes want %d, want 10 and %d", lenErr.Got, lenErr.Want, c.Layout().Size())
+	}
+
+	// The client is still usable.
+	if err := srv.SendInput(m4p.KeyWheelPressed, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := recv(t, c); err != nil {
+		t.Fatalf("Recv() after a bad payload: %v", err)
+	}
+}
+
+func TestClientLoss(t *testing.T) {
+	srv := newServer(t)
+	c, _, _ := dial(t, srv)
+
+	// Everything the server sends is lost, keepalives included.
+	srv.SetLossRate(1)
+	if err := srv.SendInput(m4p.KeyBack, true); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if m, err := c.Recv(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Recv() = %s, %v with all packets lost", m.Type, err)
+	}
+
+	// Back below the server timeout, the client is still there.
+	srv.SetLossRate(0)
+	if err := srv.SendInput(m4p.KeyWheelPressed, true); err != nil {
+		t.Fatal(err)
+	}
+	m, err := recv(t, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Input == nil || m.Input.Parameters.KeyCode != m4p.KeyWheelPressed {
+		t.Errorf("got %s %+v after the loss, want input %d", m.Type, m.Input, m4p.KeyWheelPressed)
+	}
+}
+
+func TestClientSilent(t *testing.T) {
+	srv := newServer(t)
+	c, _, _ := dial(t, srv)
+
+	// Without keepalives from the server the client gives up.
+	srv.SetSilent(true)
+	if m, err := recv(t, c); !errors.Is(err, m4p.ErrServerTimeout) {
+		t.Fatalf("Recv() = %s, %v, want %v", m.Type, err, m4p.ErrServerTimeout)
+	}
+}
+
+func TestClientKeepaliveTimeout(t *testing.T) {
+	srv := newServer(t)
+	c, _, states := dial(t, srv)
+	waitState(t, states, m4p.StateConnected, nil)
+
+	srv.SetSilent(true)
+	waitState(t, states, m4p.StateStale, nil)
+	waitState(t, states, m4p.StateDisconnected, m4p.ErrServerTimeout)
+	if _, err := recv(t, c); !errors.Is(err, m4p.ErrServerTimeout) {
+		t.Errorf("Recv() = %v, want %v", err, m4p.ErrServerTimeout)
+	}
+	if s := c.State(); s != m4p.StateDisconnected {
+		t.Errorf("State() = %v, want %v", s, m4p.StateDisconnected)
+	}
+}
+
+func TestClientStaleRecovers(t *testing.T) {
+	srv := newServer(t)
+	_, _, states := dial(t, srv)
+	waitState(t, states, m4p.StateConnected, nil)
+
+	srv.SetSilent(true)
+	waitState(t, states, m4p.StateStale, nil)
+	srv.SetSilent(false)
+	waitState(t, states, m4p.StateConnected, nil)
+}
+
+func TestClientReconnect(t *testing.T) {
+	srv := newServer(t)
+	c, _, states := dial(t, srv)
+	srv.SetSilent(true)
+	waitState(t, states, m4p.StateDisconnected, m4p.ErrServerTimeout)
+	c.Close()
+
+	srv.SetSilent(false)
+	c, _, states = dial(t, srv)
+	waitState(t, states, m4p.StateConnected, nil)
+	if err := srv.SendInput(m4p.KeyWheelPressed, true); err != nil {
+		t.Fatal(err)
+	}
+	m, err := recv(t, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Input == nil || m.Input.Parameters.KeyCode != m4p.KeyWheelPressed {
+		t.Errorf("got %s %+v after reconnecting, want input %d", m.Type, m.Input, m4p.KeyWheelPressed)
+	}
+}
+
+func TestClientLocalAddr(t *testing.T) {
+	srv := newServer(t)
+	c, _, _ := dial(t, srv, m4p.WithLocalAddr("127.0.0.1"))
+	if err := srv.SendInput(m4p.KeyBack, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := recv(t, c); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDialOptionErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []m4p.DialOption
+	}{
+		{"unknown network", []m4p.DialOption{m4p.WithNetwork("tcp")}},
+		{"invalid local address", []m4p.DialOption{m4p.WithLocalAddr("localhost")}},
+		{"IPv6 local address", []m4p.DialOption{m4p.WithLocalAddr("::1")}},
+		{"IPv4 local address", []m4p.DialOption{m4p.WithNetwork("udp6"), m4p.WithLocalAddr("127.0.0.1")}},
+		{"unknown interface", []m4p.DialOption{m4p.WithInterface("nosuchif0")}},
+		{"unknown filter", []m4p.DialOption{m4p.WithFilters("magnetometer")}},
+	}
+	for _, tt := range tests {
+		ctx, cancel := context.WithTimeout(context.Background(), testTimeout)
+		c, err := m4p.Dial(ctx, "127.0.0.1:9", append([]m4p.DialOption{m4p.WithLocalPort(0)}, tt.opts...)...)
+		cancel()
+		if err == nil {
+			c.Close()
+			t.Errorf("%s: Dial succeeded", tt.name)
+		}
+	}
+}
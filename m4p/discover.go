@@ -21,12 +21,14 @@ func NewDiscoverer(broadcastPort int) (*Discoverer, error) {
 
 	ln, err := net.ListenUDP("udp", &addr)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
 	d := &Discoverer{
-		ln:     ln,
-		device: make(chan DeviceInfo), // Unbuffered, discard when nobody is listening.
+		ln: ln,
+		// Buffer advertisements of servers broadcasting at the same time,
+		// discard them when nobody is listening.
+		device: make(chan DeviceInfo, 8),
 	}
 	go d.discover()
 
@@ -49,13 +51,18 @@ func (d *Discoverer) discover() {
 		m, err := decode(buf[:n])
 		if err != nil {
 			log.Printf("m4p: Discoverer: discover: decode failed: %v", err)
+			continue
 		}
 
 		switch m.Type {
 		case Magic4PCAdMessage:
+			if m.DeviceInfo == nil {
+				log.Printf("m4p: Discoverer: discover: %s without device info", m.Type)
+				continue
+			}
 			dev := m.DeviceInfo
 			dev.IPAddr = addr.IP.String()
-			log.Printf("m4p: Discoverer: discover: found device: %#v", dev)
+			debugf("m4p: Discoverer: discover: found device: %#v", dev)
 
 			select {
 			case d.device <- *dev:
@@ -0,0 +1,56 @@
+package m4p_test
+
+import (
+	"net"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/netham45/magic4pc_altclient/m4p"
+	"github.com/netham45/magic4pc_altclient/m4p/m4ptest"
+)
+
+// freeUDPPort returns a UDP port nothing listens on.
+func freeUDPPort(t *testing.T) int {
+	t.Helper()
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4zero})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).Port
+}
+
+func TestDiscoverer(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("needs loopback broadcasts")
+	}
+	port := freeUDPPort(t)
+	d, err := m4p.NewDiscoverer(port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	srv := newServer(t, m4ptest.WithDevice("OLED55C1", "aa:bb:cc:dd:ee:ff"))
+	// Advertisements nobody waits for are dropped, so keep advertising
+	// like the TV does.
+	tick := time.NewTicker(20 * time.Millisecond)
+	defer tick.Stop()
+	timeout := time.After(testTimeout)
+	for {
+		if err := srv.Advertise(port); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case dev := <-d.NextDevice():
+			if dev != srv.DeviceInfo() {
+				t.Errorf("discovered %+v, want %+v", dev, srv.DeviceInfo())
+			}
+			return
+		case <-tick.C:
+		case <-timeout:
+			t.Fatal("no device discovered")
+		}
+	}
+}
@@ -0,0 +1,14 @@
+package m4p
+
+import "time"
+
+// WithKeepaliveTiming shortens the client keepalive interval and how long
+// the server may stay silent before the client is stale or disconnects, so
+// tests don't wait for seconds.
+func WithKeepaliveTiming(interval, stale, timeout time.Duration) DialOption {
+	return func(o *dialOptions) {
+		o.keepaliveInterval = interval
+		o.staleTimeout = stale
+		o.serverTimeout = timeout
+	}
+}
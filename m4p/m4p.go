@@ -1,19 +1,47 @@
 package m4p
 
-import "time"
+import (
+	"log"
+	"time"
+)
 
 // Protocol constants.
 const (
 	protocolVersion         = 1
 	keepaliveTimeout        = 3 * time.Second
 	clientKeepaliveInterval = 2 * time.Second
+	// serverStaleTimeout: if TV stops sending for this long the connection is reported stale.
+	serverStaleTimeout = 5 * time.Second
 	// serverKeepaliveTimeout: if TV stops sending keepalives for this long → disconnect → reconnect.
 	serverKeepaliveTimeout = 10 * time.Second
 )
 
+// Debug enables logging of every message received from servers.
+var Debug = false
+
+func debugf(format string, v ...interface{}) {
+	if Debug {
+		log.Printf(format, v...)
+	}
+}
+
+// Default magic4pc ports.
+const (
+	// DefaultBroadcastPort is where servers send magic4pc_ad broadcasts.
+	DefaultBroadcastPort = 42830
+	// DefaultPort is the port servers accept clients on.
+	DefaultPort = 42831
+	// DefaultLocalPort is the port clients send from.
+	DefaultLocalPort = 9106
+)
+
+// DefaultUpdateFrequency is the RemoteUpdate frequency clients register with.
+const DefaultUpdateFrequency = 250
+
 // Magic remote keycodes.
 const (
 	KeyWheelPressed = 13
+	KeyPause        = 19
 	KeyChannelUp    = 33
 	KeyChannelDown  = 34
 	KeyLeft         = 37
@@ -34,15 +62,28 @@ const (
 	KeyGreen        = 404
 	KeyYellow       = 405
 	KeyBlue         = 406
+	KeyStop         = 413
+	KeyPlay         = 415
+	KeyGuide        = 458
 	KeyBack         = 461
 )
 
+// RemoteUpdate filters, each one adds a field to the sensor payload.
+const (
+	FilterReturnValue  = "returnValue"
+	FilterDeviceID     = "deviceId"
+	FilterCoordinate   = "coordinate"
+	FilterGyroscope    = "gyroscope"
+	FilterAcceleration = "acceleration"
+	FilterQuaternion   = "quaternion"
+)
+
 // DefaultFilters used for remote updates.
 var DefaultFilters = []string{
-	"returnValue",
-	"deviceId",
-	"coordinate",
-	"gyroscope",
-	"acceleration",
-	"quaternion",
+	FilterReturnValue,
+	FilterDeviceID,
+	FilterCoordinate,
+	FilterGyroscope,
+	FilterAcceleration,
+	FilterQuaternion,
 }
@@ -0,0 +1,368 @@
+// Package m4ptest provides a fake magic4pc server for exercising m4p clients
+// without an LG TV. The Server listens on loopback UDP and speaks the same
+// protocol as the webOS app: it accepts sub_sensor registrations, sends
+// keepalives, advertises itself with magic4pc_ad and emits scripted
+// input, mouse, wheel and remote_update messages.
+package m4ptest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/netham45/magic4pc_altclient/m4p"
+)
+
+// ErrNoClient is returned when sending before a client has registered.
+var ErrNoClient = errors.New("m4ptest: no client registered")
+
+// Server is a fake magic4pc server.
+type Server struct {
+	conn              *net.UDPConn
+	model             string
+	mac               string
+	keepaliveInterval time.Duration
+
+	mu         sync.Mutex
+	client     *net.UDPAddr
+	layout     m4p.Layout
+	keepalives int
+	lossRate   float64
+	silent     bool
+	rand       *rand.Rand
+
+	registered chan m4p.Register
+	done       chan struct{}
+	wg         sync.WaitGroup
+}
+
+// Option configures a Server.
+type Option func(*Server)
+
+// WithDevice sets the model and MAC address reported in advertisements.
+func WithDevice(model, mac string) Option {
+	return func(s *Server) {
+		s.model = model
+		s.mac = mac
+	}
+}
+
+// WithKeepaliveInterval sets how often the server sends keepalives to the
+// registered client.
+func WithKeepaliveInterval(d time.Duration) Option {
+	return func(s *Server) {
+		s.keepaliveInterval = d
+	}
+}
+
+// WithLossRate sets the initial packet loss probability, see SetLossRate.
+func WithLossRate(p float64) Option {
+	return func(s *Server) {
+		s.lossRate = p
+	}
+}
+
+// WithSeed seeds the random source used for packet loss.
+func WithSeed(seed int64) Option {
+	return func(s *Server) {
+		s.rand = rand.New(rand.NewSource(seed))
+	}
+}
+
+// NewServer starts a fake magic4pc server on a random loopback port.
+func NewServer(opts ...Option) (*Server, error) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		conn:              conn,
+		model:             "m4ptest",
+		mac:               "00:00:00:00:00:00",
+		keepaliveInterval: time.Second,
+		rand:              rand.New(rand.NewSource(time.Now().UnixNano())),
+		registered:        make(chan m4p.Register, 1),
+		done:              make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	s.wg.Add(2)
+	go s.serve()
+	go s.keepalive()
+
+	return s, nil
+}
+
+// Addr returns the address clients should Dial.
+func (s *Server) Addr() string {
+	return s.conn.LocalAddr().String()
+}
+
+// DeviceInfo returns the device as a Discoverer would report it.
+func (s *Server) DeviceInfo() m4p.DeviceInfo {
+	addr := s.conn.LocalAddr().(*net.UDPAddr)
+	return m4p.DeviceInfo{
+		Model:  s.model,
+		IPAddr: addr.IP.String(),
+		Port:   addr.Port,
+		MAC:    s.mac,
+	}
+}
+
+// WaitRegistered blocks until a client registers and returns its Register
+// payload. Each registration is reported once.
+func (s *Server) WaitRegistered(ctx context.Context) (m4p.Register, error) {
+	select {
+	case <-ctx.Done():
+		return m4p.Register{}, ctx.Err()
+	case <-s.done:
+		return m4p.Register{}, net.ErrClosed
+	case r := <-s.registered:
+		return r, nil
+	}
+}
+
+// ClientKeepalives returns the number of keepalives received from the
+// current client.
+func (s *Server) ClientKeepalives() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.keepalives
+}
+
+// SetLossRate makes the server drop each packet it sends or receives with
+// probability p (0 disables loss, 1 drops everything).
+func (s *Server) SetLossRate(p float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lossRate = p
+}
+
+// SetSilent stops (or resumes) all traffic from the server, including
+// keepalives, as if the TV went into standby.
+func (s *Server) SetSilent(silent bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.silent = silent
+}
+
+// Send a message to the registered client.
+func (s *Server) Send(m m4p.Message) error {
+	s.mu.Lock()
+	client := s.client
+	s.mu.Unlock()
+	if client == nil {
+		return ErrNoClient
+	}
+	return s.sendTo(client, m)
+}
+
+// SendInput sends a key press or release.
+func (s *Server) SendInput(keyCode int, down bool) error {
+	m := m4p.NewMessage(m4p.InputMessage)
+	m.Input = &m4p.Input{}
+	m.Input.Parameters.KeyCode = keyCode
+	m.Input.Parameters.IsDown = down
+	return s.Send(m)
+}
+
+// SendMouse sends a mousedown or mouseup event at x, y.
+func (s *Server) SendMouse(typ string, x, y int32) error {
+	m := m4p.NewMessage(m4p.MouseMessage)
+	m.Mouse = m4p.Mouse{Type: typ, Coordinates: m4p.Coordinates{X: x, Y: y}}
+	return s.Send(m)
+}
+
+// SendWheel sends a wheel event at x, y.
+func (s *Server) SendWheel(delta, x, y int32) error {
+	m := m4p.NewMessage(m4p.WheelMessage)
+	m.Wheel = m4p.Wheel{Delta: delta, Coordinates: m4p.Coordinates{X: x, Y: y}}
+	return s.Send(m)
+}
+
+// SendRemoteUpdate encodes f using the filters the client registered with
+// and sends it.
+func (s *Server) SendRemoteUpdate(f m4p.SensorFrame) error {
+	s.mu.Lock()
+	layout := s.layout
+	s.mu.Unlock()
+	return s.SendPayload(layout.Encode(f))
+}
+
+// SendPayload sends a remote_update with a raw payload, e.g. to exercise
+// layout validation in the client.
+func (s *Server) SendPayload(payload []byte) error {
+	m := m4p.NewMessage(m4p.RemoteUpdateMessage)
+	m.RemoteUpdate = &m4p.RemoteUpdate{Payload: payload}
+	return s.Send(m)
+}
+
+// loopbackBroadcast is the broadcast address of the loopback network.
+var loopbackBroadcast = net.IPv4(127, 255, 255, 255)
+
+// Advertise broadcasts a magic4pc_ad for this server to broadcastPort, the
+// way the TV does on its LAN. It goes to the broadcast address of the
+// loopback network, so it reaches every socket bound to the port, e.g. a
+// Discoverer listening on 0.0.0.0, without leaving the host. Linux delivers
+// loopback broadcasts, other systems may not.
+func (s *Server) Advertise(broadcastPort int) error {
+	dev := s.DeviceInfo()
+	m := m4p.NewMessage(m4p.Magic4PCAdMessage)
+	m.DeviceInfo = &dev
+	return s.sendTo(&net.UDPAddr{IP: loopbackBroadcast, Port: broadcastPort}, m)
+}
+
+// Step is a scripted message sent after Delay.
+type Step struct {
+	Delay   time.Duration
+	Message m4p.Message
+}
+
+// Play sends the steps in order, waiting for each Delay first.
+func (s *Server) Play(ctx context.Context, steps []Step) error {
+	for i, step := range steps {
+		t := time.NewTimer(step.Delay)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-s.done:
+			t.Stop()
+			return net.ErrClosed
+		case <-t.C:
+		}
+		if err := s.Send(step.Message); err != nil {
+			return fmt.Errorf("step %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// Close stops the server.
+func (s *Server) Close() error {
+	select {
+	case <-s.done:
+		return nil
+	default:
+	}
+	close(s.done)
+	err := s.conn.Close()
+	s.wg.Wait()
+	return err
+}
+
+// drop reports whether the next packet should be lost.
+func (s *Server) drop() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lossRate > 0 && s.rand.Float64() < s.lossRate
+}
+
+func (s *Server) sendTo(addr *net.UDPAddr, m m4p.Message) error {
+	b, err := json.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("json encode message failed: %w", err)
+	}
+
+	s.mu.Lock()
+	silent := s.silent
+	s.mu.Unlock()
+	if silent || s.drop() {
+		return nil
+	}
+
+	if _, err := s.conn.WriteToUDP(b, addr); err != nil {
+		return fmt.Errorf("write message failed: %w", err)
+	}
+	return nil
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+
+	var buf [1024]byte
+	for {
+		n, addr, err := s.conn.ReadFromUDP(buf[:])
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			log.Printf("m4ptest: Server: serve: read udp packet failed: %v", err)
+			continue
+		}
+		if s.drop() {
+			continue
+		}
+
+		var m m4p.Message
+		if err := json.Unmarshal(buf[:n], &m); err != nil {
+			log.Printf("m4ptest: Server: serve: decode failed: %v", err)
+			continue
+		}
+
+		switch m.Type {
+		case "":
+			// Client keepalive ("{}").
+			s.mu.Lock()
+			if s.client != nil && s.client.String() == addr.String() {
+				s.keepalives++
+			}
+			s.mu.Unlock()
+
+		case m4p.SubSensorMessage:
+			if m.Register == nil {
+				log.Printf("m4ptest: Server: serve: %s without payload", m.Type)
+				continue
+			}
+			layout, err := m4p.NewLayout(m.Register.Filter)
+			if err != nil {
+				log.Printf("m4ptest: Server: serve: bad register: %v", err)
+				continue
+			}
+
+			s.mu.Lock()
+			s.client = addr
+			s.layout = layout
+			s.keepalives = 0
+			s.mu.Unlock()
+
+			// Keep only the latest registration.
+			select {
+			case <-s.registered:
+			default:
+			}
+			s.registered <- *m.Register
+
+		default:
+			log.Printf("m4ptest: Server: serve: unexpected message: %s", m.Type)
+		}
+	}
+}
+
+func (s *Server) keepalive() {
+	defer s.wg.Done()
+
+	t := time.NewTicker(s.keepaliveInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-t.C:
+			err := s.Send(m4p.NewMessage(m4p.KeepAliveMessage))
+			if err != nil && !errors.Is(err, ErrNoClient) && !errors.Is(err, net.ErrClosed) {
+				log.Printf("m4ptest: Server: keepalive: %v", err)
+			}
+		}
+	}
+}
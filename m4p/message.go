@@ -61,10 +61,12 @@ type Input struct {
 	} `json:"parameters"`
 }
 
-// RemoteUpdate event, sensor data from the magic remote.
+// RemoteUpdate event, sensor data from the magic remote. The payload layout
+// depends on the filters registered with the server, see Decode.
 type RemoteUpdate struct {
-	// filters []string
 	Payload []byte `json:"payload"`
+	// Layout negotiated by the Client that received the update.
+	Layout *Layout `json:"-"`
 }
 
 type Coordinates struct {
@@ -82,22 +84,6 @@ type Wheel struct {
 	Coordinates
 }
 
-// type (
-// 	ReturnValue  uint8
-// 	DeviceID     uint8
-// 	Gyroscope    struct{ X, Y, Z float32 }
-// 	Acceleration struct{ X, Y, Z float32 }
-// 	Quaternion   struct{ Q0, Q1, Q2, Q3 float32 }
-// )
-
-// func (ru RemoteUpdate) Coordinates() Coordinates {
-// 	return Coordinates{}
-// }
-
-// func (ru RemoteUpdate) Acceleration() Acceleration {
-// 	return Acceleration{}
-// }
-
 func decode(b []byte) (Message, error) {
 	var m Message
 	dec := json.NewDecoder(bytes.NewReader(b))
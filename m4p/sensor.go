@@ -0,0 +1,167 @@
+package m4p
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Sensor values contained in a RemoteUpdate payload.
+type (
+	ReturnValue  uint8
+	DeviceID     uint8
+	Gyroscope    struct{ X, Y, Z float32 }
+	Acceleration struct{ X, Y, Z float32 }
+	Quaternion   struct{ Q0, Q1, Q2, Q3 float32 }
+)
+
+// SensorFrame is a decoded RemoteUpdate payload. Only the fields whose
+// filter was registered are populated, use Has to tell them apart from
+// zero values.
+type SensorFrame struct {
+	ReturnValue  ReturnValue
+	DeviceID     DeviceID
+	Coordinate   Coordinates
+	Gyroscope    Gyroscope
+	Acceleration Acceleration
+	Quaternion   Quaternion
+
+	present map[string]bool
+}
+
+// Has reports whether the frame contains the value for filter.
+func (f SensorFrame) Has(filter string) bool {
+	return f.present[filter]
+}
+
+// filterSize is the encoded size in bytes of the value for each filter.
+var filterSize = map[string]int{
+	FilterReturnValue:  1,
+	FilterDeviceID:     1,
+	FilterCoordinate:   8,
+	FilterGyroscope:    12,
+	FilterAcceleration: 12,
+	FilterQuaternion:   16,
+}
+
+// Layout describes the RemoteUpdate payload sent by the server for the
+// filters a client registered with.
+type Layout struct {
+	filters []string
+	size    int
+}
+
+// NewLayout returns the payload layout for filters, in registration order.
+func NewLayout(filters []string) (Layout, error) {
+	l := Layout{filters: append([]string(nil), filters...)}
+	for _, filter := range filters {
+		n, ok := filterSize[filter]
+		if !ok {
+			return Layout{}, fmt.Errorf("unknown filter: %q", filter)
+		}
+		l.size += n
+	}
+	return l, nil
+}
+
+// Filters returns the filters making up the layout, in payload order.
+func (l Layout) Filters() []string {
+	return append([]string(nil), l.filters...)
+}
+
+// Size returns the expected payload length in bytes.
+func (l Layout) Size() int {
+	return l.size
+}
+
+// PayloadLengthError is returned when a RemoteUpdate payload does not match
+// the negotiated layout.
+type PayloadLengthError struct {
+	Filters []string
+	Want    int
+	Got     int
+}
+
+func (e *PayloadLengthError) Error() string {
+	return fmt.Sprintf("remote update payload is %d bytes, want %d for %v", e.Got, e.Want, e.Filters)
+}
+
+// Decode payload into a SensorFrame.
+func (l Layout) Decode(payload []byte) (SensorFrame, error) {
+	if len(payload) != l.size {
+		return SensorFrame{}, &PayloadLengthError{Filters: l.Filters(), Want: l.size, Got: len(payload)}
+	}
+
+	f := SensorFrame{present: make(map[string]bool, len(l.filters))}
+	r := bytes.NewReader(payload)
+	for _, filter := range l.filters {
+		var v interface{}
+		switch filter {
+		case FilterReturnValue:
+			v = &f.ReturnValue
+		case FilterDeviceID:
+			v = &f.DeviceID
+		case FilterCoordinate:
+			v = &f.Coordinate
+		case FilterGyroscope:
+			v = &f.Gyroscope
+		case FilterAcceleration:
+			v = &f.Acceleration
+		case FilterQuaternion:
+			v = &f.Quaternion
+		}
+		if err := binary.Read(r, binary.LittleEndian, v); err != nil {
+			return SensorFrame{}, fmt.Errorf("decode %s failed: %w", filter, err)
+		}
+		f.present[filter] = true
+	}
+
+	return f, nil
+}
+
+// Encode f into a payload, the inverse of Decode. Values for filters that
+// are not part of the layout are ignored.
+func (l Layout) Encode(f SensorFrame) []byte {
+	var buf bytes.Buffer
+	buf.Grow(l.size)
+	for _, filter := range l.filters {
+		var v interface{}
+		switch filter {
+		case FilterReturnValue:
+			v = f.ReturnValue
+		case FilterDeviceID:
+			v = f.DeviceID
+		case FilterCoordinate:
+			v = f.Coordinate
+		case FilterGyroscope:
+			v = f.Gyroscope
+		case FilterAcceleration:
+			v = f.Acceleration
+		case FilterQuaternion:
+			v = f.Quaternion
+		}
+		// Writes to a bytes.Buffer of fixed-size values cannot fail.
+		_ = binary.Write(&buf, binary.LittleEndian, v)
+	}
+	return buf.Bytes()
+}
+
+// Decode the payload into a SensorFrame. The server packs the values in the
+// order of the filters sent with Register, so filters must be the same list
+// that was passed to WithFilters (DefaultFilters if none).
+func (ru RemoteUpdate) Decode(filters []string) (SensorFrame, error) {
+	l, err := NewLayout(filters)
+	if err != nil {
+		return SensorFrame{}, err
+	}
+	return l.Decode(ru.Payload)
+}
+
+// Frame decodes the payload using the Layout attached by Client.Recv.
+func (ru RemoteUpdate) Frame() (SensorFrame, error) {
+	if ru.Layout == nil {
+		return SensorFrame{}, errors.New("remote update has no layout")
+	}
+	return ru.Layout.Decode(ru.Payload)
+}
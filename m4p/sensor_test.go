@@ -0,0 +1,212 @@
+package m4p_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/netham45/magic4pc_altclient/m4p"
+)
+
+// testFrame has a distinct value for every filter.
+var testFrame = m4p.SensorFrame{
+	ReturnValue:  1,
+	DeviceID:     2,
+	Coordinate:   m4p.Coordinates{X: 960, Y: -540},
+	Gyroscope:    m4p.Gyroscope{X: 0.5, Y: -1.25, Z: 2},
+	Acceleration: m4p.Acceleration{X: -9.75, Y: 0.125, Z: 3},
+	Quaternion:   m4p.Quaternion{Q0: 1, Q1: -0.5, Q2: 0.25, Q3: -0.125},
+}
+
+// filterCombinations returns every subset of DefaultFilters, in payload
+// order.
+func filterCombinations() [][]string {
+	var combos [][]string
+	for mask := 0; mask < 1<<len(m4p.DefaultFilters); mask++ {
+		var filters []string
+		for i, f := range m4p.DefaultFilters {
+			if mask&(1<<i) != 0 {
+				filters = append(filters, f)
+			}
+		}
+		combos = append(combos, filters)
+	}
+	return combos
+}
+
+// encode packs the values of f for filters the way the TV does.
+func encode(t *testing.T, filters []string, f m4p.SensorFrame) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	for _, filter := range filters {
+		var v interface{}
+		switch filter {
+		case m4p.FilterReturnValue:
+			v = f.ReturnValue
+		case m4p.FilterDeviceID:
+			v = f.DeviceID
+		case m4p.FilterCoordinate:
+			v = f.Coordinate
+		case m4p.FilterGyroscope:
+			v = f.Gyroscope
+		case m4p.FilterAcceleration:
+			v = f.Acceleration
+		case m4p.FilterQuaternion:
+			v = f.Quaternion
+		}
+		if err := binary.Write(&b, binary.LittleEndian, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return b.Bytes()
+}
+
+func TestRemoteUpdateDecode(t *testing.T) {
+	for _, filters := range filterCombinations() {
+		ru := m4p.RemoteUpdate{Payload: encode(t, filters, testFrame)}
+		f, err := ru.Decode(filters)
+		if err != nil {
+			t.Errorf("%v: Decode: %v", filters, err)
+			continue
+		}
+
+		want := map[string]bool{}
+		for _, filter := range filters {
+			want[filter] = true
+		}
+		for _, filter := range m4p.DefaultFilters {
+			if f.Has(filter) != want[filter] {
+				t.Errorf("%v: Has(%s) = %v, want %v", filters, filter, f.Has(filter), want[filter])
+			}
+		}
+		check := func(filter string, got, want interface{}) {
+			if f.Has(filter) && got != want {
+				t.Errorf("%v: %s = %v, want %v", filters, filter, got, want)
+			}
+		}
+		check(m4p.FilterReturnValue, f.ReturnValue, testFrame.ReturnValue)
+		check(m4p.FilterDeviceID, f.DeviceID, testFrame.DeviceID)
+		check(m4p.FilterCoordinate, f.Coordinate, testFrame.Coordinate)
+		check(m4p.FilterGyroscope, f.Gyroscope, testFrame.Gyroscope)
+		check(m4p.FilterAcceleration, f.Acceleration, testFrame.Acceleration)
+		check(m4p.FilterQuaternion, f.Quaternion, testFrame.Quaternion)
+	}
+}
+
+func TestRemoteUpdateDecodeErrors(t *testing.T) {
+	payload := encode(t, m4p.DefaultFilters, testFrame)
+	tests := []struct {
+		name    string
+		payload []byte
+		filters []string
+	}{
+		{"short", payload[:len(payload)-1], m4p.DefaultFilters},
+		{"trailing bytes", append(payload, 0), m4p.DefaultFilters},
+		{"fewer filters", payload, m4p.DefaultFilters[1:]},
+		{"unknown filter", payload, []string{m4p.FilterCoordinate, "magnetometer"}},
+	}
+	for _, tt := range tests {
+		ru := m4p.RemoteUpdate{Payload: tt.payload}
+		if _, err := ru.Decode(tt.filters); err == nil {
+			t.Errorf("%s: Decode succeeded", tt.name)
+		}
+	}
+}
+
+func TestLayoutSize(t *testing.T) {
+	tests := []struct {
+		filters []string
+		want    int
+	}{
+		{nil, 0},
+		{[]string{m4p.FilterReturnValue}, 1},
+		{[]string{m4p.FilterCoordinate}, 8},
+		{[]string{m4p.FilterGyroscope, m4p.FilterAcceleration}, 24},
+		{[]string{m4p.FilterQuaternion, m4p.FilterDeviceID}, 17},
+		{m4p.DefaultFilters, 50},
+	}
+	for _, tt := range tests {
+		l, err := m4p.NewLayout(tt.filters)
+		if err != nil {
+			t.Errorf("NewLayout(%v): %v", tt.filters, err)
+			continue
+		}
+		if got := l.Size(); got != tt.want {
+			t.Errorf("NewLayout(%v).Size() = %d, want %d", tt.filters, got, tt.want)
+		}
+	}
+}
+
+func TestNewLayoutUnknownFilter(t *testing.T) {
+	if _, err := m4p.NewLayout([]string{m4p.FilterCoordinate, "magnetometer"}); err == nil {
+		t.Fatal("NewLayout with an unknown filter succeeded")
+	}
+}
+
+func TestLayoutRoundTrip(t *testing.T) {
+	for _, filters := range filterCombinations() {
+		l, err := m4p.NewLayout(filters)
+		if err != nil {
+			t.Fatalf("NewLayout(%v): %v", filters, err)
+		}
+		payload := l.Encode(testFrame)
+		if want := encode(t, filters, testFrame); !bytes.Equal(payload, want) {
+			t.Errorf("%v: Encode = %x, want %x", filters, payload, want)
+		}
+		f, err := l.Decode(payload)
+		if err != nil {
+			t.Errorf("%v: Decode: %v", filters, err)
+			continue
+		}
+		if got := l.Encode(f); !bytes.Equal(got, payload) {
+			t.Errorf("%v: Encode(Decode(p)) = %x, want %x", filters, got, payload)
+		}
+	}
+}
+
+func TestLayoutDecodeLength(t *testing.T) {
+	for _, filters := range filterCombinations() {
+		l, err := m4p.NewLayout(filters)
+		if err != nil {
+			t.Fatalf("NewLayout(%v): %v", filters, err)
+		}
+		if _, err := l.Decode(encode(t, filters, testFrame)); err != nil {
+			t.Errorf("%v: Decode: %v", filters, err)
+		}
+		for _, n := range []int{l.Size() - 1, l.Size() + 1, 0, 1024} {
+			if n < 0 || n == l.Size() {
+				continue
+			}
+			_, err := l.Decode(make([]byte, n))
+			var lenErr *m4p.PayloadLengthError
+			if !errors.As(err, &lenErr) {
+				t.Errorf("%v: Decode(%d bytes) = %v, want PayloadLengthError", filters, n, err)
+				continue
+			}
+			if lenErr.Want != l.Size() || lenErr.Got != n {
+				t.Errorf("%v: Decode(%d bytes): want %d got %d, want %d got %d",
+					filters, n, lenErr.Want, lenErr.Got, l.Size(), n)
+			}
+		}
+	}
+}
+
+func TestRemoteUpdateFrame(t *testing.T) {
+	l, err := m4p.NewLayout(m4p.DefaultFilters)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ru := m4p.RemoteUpdate{Payload: encode(t, m4p.DefaultFilters, testFrame)}
+	if _, err := ru.Frame(); err == nil {
+		t.Error("Frame without a layout succeeded")
+	}
+	ru.Layout = &l
+	f, err := ru.Frame()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Quaternion != testFrame.Quaternion {
+		t.Errorf("Quaternion = %v, want %v", f.Quaternion, testFrame.Quaternion)
+	}
+}
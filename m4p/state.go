@@ -0,0 +1,88 @@
+package m4p
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// State of a connection to a magic4pc server.
+type State int
+
+// Connection states. A Client goes through registering, connected and stale
+// to disconnected, discovering and backoff are for the code driving it.
+const (
+	// StateDisconnected is the state before the first Dial and after Close.
+	StateDisconnected State = iota
+	// StateDiscovering waits for the server's magic4pc_ad broadcast.
+	StateDiscovering
+	// StateRegistering has sent sub_sensor and waits for the server's
+	// first message.
+	StateRegistering
+	// StateConnected receives messages from the server.
+	StateConnected
+	// StateStale hasn't heard from the server for serverStaleTimeout, it is
+	// disconnected after serverKeepaliveTimeout.
+	StateStale
+	// StateBackoff waits before connecting again.
+	StateBackoff
+)
+
+var stateNames = [...]string{
+	StateDisconnected: "disconnected",
+	StateDiscovering:  "discovering",
+	StateRegistering:  "registering",
+	StateConnected:    "connected",
+	StateStale:        "stale",
+	StateBackoff:      "backoff",
+}
+
+func (s State) String() string {
+	if s < 0 || int(s) >= len(stateNames) {
+		return "unknown"
+	}
+	return stateNames[s]
+}
+
+// ErrServerTimeout is returned by Recv once the server has been silent for
+// too long and the client has closed itself.
+var ErrServerTimeout = errors.New("m4p: server keepalive timeout")
+
+// WithStateFunc sets a function called on every state change of the client,
+// along with the error that caused it, if any. It is called from the
+// client's goroutines and must not block.
+func WithStateFunc(f func(s State, err error)) func(*dialOptions) {
+	return func(o *dialOptions) {
+		o.stateFunc = f
+	}
+}
+
+// Backoff computes exponentially growing, jittered delays between
+// reconnects.
+type Backoff struct {
+	// Min is the first delay and Max the largest one.
+	Min, Max time.Duration
+	// Jitter randomizes each delay by up to this fraction, e.g. 0.2 for
+	// ±20%, so clients don't retry in lockstep.
+	Jitter float64
+
+	attempt int
+}
+
+// Next returns the delay before the next attempt.
+func (b *Backoff) Next() time.Duration {
+	d := float64(b.Min) * math.Pow(2, float64(b.attempt))
+	if d >= float64(b.Max) {
+		d = float64(b.Max)
+	} else {
+		b.attempt++
+	}
+	d *= 1 + b.Jitter*(2*rand.Float64()-1)
+	return time.Duration(d)
+}
+
+// Reset starts over at Min, e.g. after a successful connection.
+func (b *Backoff) Reset() {
+	b.attempt = 0
+}
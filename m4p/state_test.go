@@ -0,0 +1,49 @@
+package m4p_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/netham45/magic4pc_altclient/m4p"
+)
+
+func TestBackoff(t *testing.T) {
+	b := m4p.Backoff{Min: 100 * time.Millisecond, Max: time.Second}
+	want := []time.Duration{100, 200, 400, 800, 1000, 1000}
+	for i, w := range want {
+		if got := b.Next(); got != w*time.Millisecond {
+			t.Errorf("attempt %d: Next() = %v, want %v", i, got, w*time.Millisecond)
+		}
+	}
+	b.Reset()
+	if got := b.Next(); got != b.Min {
+		t.Errorf("Next() after Reset = %v, want %v", got, b.Min)
+	}
+}
+
+func TestBackoffJitter(t *testing.T) {
+	const jitter = 0.2
+	for run := 0; run < 100; run++ {
+		b := m4p.Backoff{Min: 100 * time.Millisecond, Max: time.Second, Jitter: jitter}
+		base := b.Min
+		for i := 0; i < 8; i++ {
+			lo := time.Duration(float64(base) * (1 - jitter))
+			hi := time.Duration(float64(base) * (1 + jitter))
+			if got := b.Next(); got < lo || got > hi {
+				t.Fatalf("attempt %d: Next() = %v, want within [%v, %v]", i, got, lo, hi)
+			}
+			if base *= 2; base > b.Max {
+				base = b.Max
+			}
+		}
+	}
+}
+
+func TestStateString(t *testing.T) {
+	if got := m4p.StateStale.String(); got != "stale" {
+		t.Errorf("StateStale.String() = %q", got)
+	}
+	if got := m4p.State(-1).String(); got != "unknown" {
+		t.Errorf("State(-1).String() = %q", got)
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// MacroStep is one step of a macro action. Exactly one field is set.
+type MacroStep struct {
+	// Down presses and Up releases a key, by X keysym name.
+	Down string `json:"down,omitempty"`
+	Up   string `json:"up,omitempty"`
+	// Tap presses and releases a key.
+	Tap string `json:"tap,omitempty"`
+	// Text types UTF-8 text.
+	Text string `json:"text,omitempty"`
+	// Move moves the pointer.
+	Move *MacroMove `json:"move,omitempty"`
+	// Click presses and releases a mouse button.
+	Click string `json:"click,omitempty"`
+	// Scroll the wheel by this many notches, up when positive.
+	Scroll int `json:"scroll,omitempty"`
+	// Sleep pauses before the next step.
+	Sleep duration `json:"sleep,omitempty"`
+}
+
+// MacroMove moves the pointer to X, Y in desktop pixels, or by X, Y when
+// Relative is set.
+type MacroMove struct {
+	X        int  `json:"x"`
+	Y        int  `json:"y"`
+	Relative bool `json:"relative,omitempty"`
+}
+
+func (m MacroStep) validate() error {
+	n := 0
+	for _, set := range []bool{m.Down != "", m.Up != "", m.Tap != "", m.Text != "", m.Move != nil, m.Click != "", m.Scroll != 0, m.Sleep != 0} {
+		if set {
+			n++
+		}
+	}
+	if n != 1 {
+		return fmt.Errorf("macro step must set exactly one of down, up, tap, text, move, click, scroll or sleep")
+	}
+	if m.Sleep < 0 {
+		return fmt.Errorf("macro sleep must not be negative")
+	}
+	return nil
+}
+
+// validateMacro checks the steps of a macro and the backend it runs on.
+func validateMacro(steps []MacroStep, backend string) error {
+	for i, m := range steps {
+		if err := m.validate(); err != nil {
+			return fmt.Errorf("macro step %d: %w", i+1, err)
+		}
+	}
+	if backend != "" {
+		if _, ok := sinkFactories[backend]; !ok {
+			return fmt.Errorf("unknown macro backend %q", backend)
+		}
+	}
+	return nil
+}
+
+// macroMu runs one macro at a time, so the steps of two macros don't
+// interleave.
+var macroMu sync.Mutex
+
+// macros holds the context of the running and waiting macros, stopMacros
+// cancels it.
+var macros struct {
+	mu     sync.Mutex
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// macroContext returns the context macros started now run with.
+func macroContext() context.Context {
+	macros.mu.Lock()
+	defer macros.mu.Unlock()
+	if macros.ctx == nil {
+		macros.ctx, macros.cancel = context.WithCancel(context.Background())
+	}
+	return macros.ctx
+}
+
+// stopMacros cuts short the running macro and drops those waiting for it.
+func stopMacros() {
+	macros.mu.Lock()
+	defer macros.mu.Unlock()
+	if macros.cancel != nil {
+		macros.cancel()
+		macros.ctx, macros.cancel = nil, nil
+	}
+}
+
+// runMacro runs the steps in order until ctx is done. Keys still held at the
+// end, or when cut short, are released.
+func runMacro(ctx context.Context, s InputSink, steps []MacroStep) {
+	macroMu.Lock()
+	defer macroMu.Unlock()
+
+	var held []string
+	release := func(key string) {
+		for i, k := range held {
+			if k == key {
+				held = append(held[:i], held[i+1:]...)
+				break
+			}
+		}
+	}
+	for _, m := range steps {
+		if ctx.Err() != nil {
+			break
+		}
+		switch {
+		case m.Down != "":
+			s.Key(m.Down, true)
+			held = append(held, m.Down)
+		case m.Up != "":
+			s.Key(m.Up, false)
+			release(m.Up)
+		case m.Tap != "":
+			s.Key(m.Tap, true)
+			s.Key(m.Tap, false)
+		case m.Text != "":
+			s.Type(m.Text)
+		case m.Move != nil:
+			if m.Move.Relative {
+				s.MoveRelative(m.Move.X, m.Move.Y)
+			} else {
+				s.Move(m.Move.X, m.Move.Y)
+			}
+		case m.Click != "":
+			s.Click(m.Click, true)
+			s.Click(m.Click, false)
+		case m.Scroll != 0:
+			s.Scroll(0, m.Scroll)
+		case m.Sleep != 0:
+			t := time.NewTimer(time.Duration(m.Sleep))
+			select {
+			case <-t.C:
+			case <-ctx.Done():
+				t.Stop()
+			}
+		}
+	}
+	for i := len(held) - 1; i >= 0; i-- {
+		s.Key(held[i], false)
+	}
+}
+
+// startMacro runs a macro on its own goroutine, through the named backend
+// or s if none is given.
+func startMacro(s InputSink, steps []MacroStep, backend string) {
+	if backend != "" {
+		var err error
+		if s, err = sinks.get(backend); err != nil {
+			log.Printf("macro: %v", err)
+			return
+		}
+	}
+	go runMacro(macroContext(), s, steps)
+}
+
+// steamShortcut taps Ctrl+key on a backend that reaches gamescope, used for
+// the Steam Big Picture menus.
+func steamShortcut(s InputSink, key string) {
+	s, err := kernelBackend(s)
+	if err != nil {
+		log.Printf("steamShortcut: ctrl+%s: %v", key, err)
+		return
+	}
+	go runMacro(macroContext(), s, []MacroStep{{Down: "ctrl"}, {Tap: key}, {Up: "ctrl"}})
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/netham45/magic4pc_altclient/m4p"
+)
+
+func TestRunMacro(t *testing.T) {
+	sink := &recordSink{}
+	runMacro(context.Background(), sink, []MacroStep{
+		{Down: "ctrl"},
+		{Tap: "a"},
+		{Up: "ctrl"},
+		{Text: "Hi\n"},
+		{Move: &MacroMove{X: 10, Y: 20}},
+		{Move: &MacroMove{X: -3, Y: 4, Relative: true}},
+		{Click: "right"},
+		{Scroll: 1},
+	})
+	expectEvents(t, sink,
+		"key ctrl down", "key a down", "key a up", "key ctrl up",
+		`type "Hi\n"`,
+		"move 10 20", "moverel -3 4",
+		"click right down", "click right up",
+		"scroll 0 1")
+}
+
+func TestRunMacroSleep(t *testing.T) {
+	sink := &recordSink{}
+	start := time.Now()
+	runMacro(context.Background(), sink, []MacroStep{
+		{Tap: "a"},
+		{Sleep: duration(30 * time.Millisecond)},
+		{Tap: "b"},
+	})
+	if d := time.Since(start); d < 30*time.Millisecond {
+		t.Errorf("macro took %v, want at least 30ms", d)
+	}
+	expectEvents(t, sink, "key a down", "key a up", "key b down", "key b up")
+}
+
+func TestRunMacroReleasesHeldKeys(t *testing.T) {
+	sink := &recordSink{}
+	runMacro(context.Background(), sink, []MacroStep{
+		{Down: "shift"},
+		{Down: "ctrl"},
+		{Down: "a"},
+		{Up: "ctrl"},
+	})
+	expectEvents(t, sink, "key shift down", "key ctrl down", "key a down", "key ctrl up",
+		"key a up", "key shift up")
+}
+
+func TestRunMacroCancel(t *testing.T) {
+	sink := &recordSink{}
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	start := time.Now()
+	runMacro(ctx, sink, []MacroStep{
+		{Down: "ctrl"},
+		{Sleep: duration(10 * time.Second)},
+		{Tap: "c"},
+	})
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("cancelled macro took %v", d)
+	}
+	expectEvents(t, sink, "key ctrl down", "key ctrl up")
+}
+
+func TestLockInputStopsMacros(t *testing.T) {
+	h, sink := newTestHandler(t, `{
+		"keys": {"red": {"macro": [{"down": "ctrl"}, {"sleep": "10s"}, {"tap": "c"}]}}
+	}`)
+	h.key(m4p.KeyRed, true)
+	h.key(m4p.KeyRed, false)
+	waitEvents(t, sink, 1)
+	runBuiltin(h, "lock-input")
+	waitEvents(t, sink, 2)
+	expectEvents(t, sink, "key ctrl down", "key ctrl up")
+}
+
+func TestValidateMacro(t *testing.T) {
+	tests := []struct {
+		name    string
+		steps   []MacroStep
+		backend string
+		ok      bool
+	}{
+		{"valid", []MacroStep{{Down: "ctrl"}, {Tap: "c"}, {Up: "ctrl"}, {Sleep: duration(time.Second)}}, "", true},
+		{"backend", []MacroStep{{Tap: "a"}}, "record", true},
+		{"empty step", []MacroStep{{Tap: "a"}, {}}, "", false},
+		{"two fields", []MacroStep{{Tap: "a", Click: "left"}}, "", false},
+		{"negative sleep", []MacroStep{{Sleep: duration(-time.Second)}}, "", false},
+		{"unknown backend", []MacroStep{{Tap: "a"}}, "wayland", false},
+	}
+	for _, tt := range tests {
+		err := validateMacro(tt.steps, tt.backend)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: validateMacro() = %v", tt.name, err)
+		}
+	}
+}
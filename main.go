@@ -1,18 +1,16 @@
 package main
 
 import (
-	"bytes"
 	"context"
-	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"net"
 	"os"
 	"os/signal"
-	"strconv"
-	"strings"
 	"syscall"
-	"time"
 
 	"github.com/netham45/magic4pc_altclient/m4p"
 )
@@ -22,47 +20,87 @@ const tvWidth = 1920.0
 const tvHeight = 1080.0
 
 func main() {
-	inputInit()
+	cfg, flags, err := parseConfig(os.Args[0], os.Args[1:], os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		if err != errUsage {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		os.Exit(2)
+	}
+	debugLog = cfg.LogLevel == logDebug
+	m4p.Debug = debugLog
+
+	if flags.printConfig {
+		b, _ := json.MarshalIndent(cfg, "", "  ")
+		fmt.Println(string(b))
+		return
+	}
+	if flags.printMapping {
+		b, _ := json.MarshalIndent(defaultMapping(), "", "  ")
+		fmt.Println(string(b))
+		return
+	}
+
+	sinks.opts = sinkOptions{uinputPath: cfg.UinputDevice}
+	sink, err := sinks.get(cfg.Backend)
+	if err != nil {
+		log.Fatalf("input backend: %v", err)
+	}
+	defer sinks.close()
+
+	// Close the backends on a signal, also those opened for macros, so the
+	// uinput devices are destroyed.
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 	go func() {
 		<-c
+		sinks.close()
 		os.Exit(1)
 	}()
 
-	go startUDPListener()
-
-	ipAddr := "192.168.1.75"
-	port := 42831
+	if cfg.ListenAddr != "" {
+		go startUDPListener(cfg.ListenAddr)
+	}
 
-	if len(os.Args) > 1 {
-		ipAddr = os.Args[1]
-		if len(os.Args) > 2 {
-			var err error
-			port, err = strconv.Atoi(os.Args[2])
-			if err != nil {
-				log.Fatalf("invalid port: %v", err)
+	ctx := context.Background()
+	var hub *discoveryHub
+	for _, tv := range cfg.tvs() {
+		mapping, err := loadMapping(tv.Mapping)
+		if err != nil {
+			log.Fatalf("%s: mapping: %v", tv.Name, err)
+		}
+		profiles := newProfileSelector(mapping)
+		go profiles.run(ctx)
+		screen := newScreenMapper(tv.Output)
+		go screen.run(ctx)
+		h := newHandler(sink, mapping, profiles, screen)
+
+		var tracker *deviceTracker
+		if tv.Address == "" {
+			if hub == nil {
+				hub = &discoveryHub{}
 			}
+			tracker = hub.add(deviceFilter{model: tv.Model, mac: tv.MAC})
 		}
+		go newTVConn(cfg, tv, tracker, h).run(ctx)
 	}
 
-	dev := m4p.DeviceInfo{IPAddr: ipAddr, Port: port}
-	for {
-		if err := connect(context.Background(), dev); err != nil {
-			if err == context.Canceled {
-				fmt.Println("Exiting 2...")
-			}
-			fmt.Println("Failed to connect,", err, "retrying in 2 seconds...")
+	if hub != nil {
+		d, err := m4p.NewDiscoverer(cfg.Discovery.Port)
+		if err != nil {
+			log.Fatalf("discovery failed: %v", err)
 		}
-		time.Sleep(2 * time.Second)
+		defer d.Close()
+		log.Printf("waiting for magic4pc_ad broadcasts on port %d...", cfg.Discovery.Port)
+		go hub.run(ctx, d)
 	}
+	select {}
 }
 
-const (
-	listenAddr = "0.0.0.0:9105"
-)
-
-func startUDPListener() {
+func startUDPListener(listenAddr string) {
 	udpAddr, err := net.ResolveUDPAddr("udp", listenAddr)
 	if err != nil {
 		fmt.Println("Error resolving UDP address:", err)
@@ -85,103 +123,3 @@ func startUDPListener() {
 		fmt.Printf("Received UDP packet from %s: %s\n", addr.String(), string(buffer[:n]))
 	}
 }
-
-func connect(ctx context.Context, dev m4p.DeviceInfo) error {
-	addr := fmt.Sprintf("%s:%d", dev.IPAddr, dev.Port)
-	log.Printf("hola! connecting to: %s", addr)
-
-	client, err := m4p.Dial(ctx, addr)
-	if err != nil {
-		return err
-	}
-	defer client.Close()
-
-	for {
-		m, err := client.Recv(ctx)
-		if err != nil {
-			return err
-		}
-
-		switch m.Type {
-		case m4p.InputMessage:
-			key := m.Input.Parameters.KeyCode
-			pressed := m.Input.Parameters.IsDown
-			log.Printf("Key: %d pressed: %v", key, pressed)
-			switch key {
-			case 37: // Left
-				inputKey("Left", pressed)
-			case 38: // Up
-				inputKey("Up", pressed)
-			case 39: // Right
-				inputKey("Right", pressed)
-			case 40: // Down
-				inputKey("Down", pressed)
-			case 415: // play
-				inputKey("XF86AudioPlay", pressed)
-			case 413: // stop
-				inputKey("XF86AudioStop", pressed)
-			case 0x13: // pause
-				inputKey("XF86AudioPause", pressed)
-			case 461: // back
-				inputBackKey(pressed)
-			case 403: // red — platform-specific (Steam menu / Super)
-				inputRedKey(pressed)
-			case 404: // green
-				inputKey("Escape", pressed)
-			case 33: // Ch Up
-				inputKey("Prior", pressed)
-			case 34: // Ch Down
-				inputKey("Next", pressed)
-			case 405: // yellow — platform-specific (Steam QAM / middle click)
-				inputYellowKey(pressed)
-			case 406: // blue → right click
-				inputClick("right", pressed)
-			case 13: // Enter
-				inputKey("Return", pressed)
-			case 458: // GUIDE
-				inputClick("right", pressed)
-			default:
-				if key >= 32 && key < 127 {
-					// ASCII range — send as character
-					inputKey(strings.ToLower(string(rune(key))), pressed)
-				}
-			}
-
-		case m4p.RemoteUpdateMessage:
-			r := bytes.NewReader(m.RemoteUpdate.Payload)
-			var returnValue, deviceID uint8
-			var coordinate [2]int32
-			var gyroscope, acceleration [3]float32
-			var quaternion [4]float32
-			for _, fn := range []func() error{
-				func() error { return binary.Read(r, binary.LittleEndian, &returnValue) },
-				func() error { return binary.Read(r, binary.LittleEndian, &deviceID) },
-				func() error { return binary.Read(r, binary.LittleEndian, coordinate[:]) },
-				func() error { return binary.Read(r, binary.LittleEndian, gyroscope[:]) },
-				func() error { return binary.Read(r, binary.LittleEndian, acceleration[:]) },
-				func() error { return binary.Read(r, binary.LittleEndian, quaternion[:]) },
-			} {
-				if err := fn(); err != nil {
-					log.Printf("connect: %s decode failed: %v", m.Type, err)
-					break
-				}
-			}
-			if coordinate[0] != 0 || coordinate[1] != 0 {
-				inputMove(int(coordinate[0]), int(coordinate[1]))
-			}
-
-		case m4p.MouseMessage:
-			switch m.Mouse.Type {
-			case "mousedown":
-				inputClick("left", true)
-			case "mouseup":
-				inputClick("left", false)
-			}
-
-		case m4p.WheelMessage:
-			inputScroll(int(m.Wheel.Delta))
-
-		default:
-		}
-	}
-}
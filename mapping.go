@@ -0,0 +1,419 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/netham45/magic4pc_altclient/m4p"
+)
+
+// keyNames are the names a mapping file can use instead of keycodes.
+var keyNames = map[string]int{
+	"wheel":       m4p.KeyWheelPressed,
+	"pause":       m4p.KeyPause,
+	"channelup":   m4p.KeyChannelUp,
+	"channeldown": m4p.KeyChannelDown,
+	"left":        m4p.KeyLeft,
+	"up":          m4p.KeyUp,
+	"right":       m4p.KeyRight,
+	"down":        m4p.KeyDown,
+	"key0":        m4p.Key0,
+	"key1":        m4p.Key1,
+	"key2":        m4p.Key2,
+	"key3":        m4p.Key3,
+	"key4":        m4p.Key4,
+	"key5":        m4p.Key5,
+	"key6":        m4p.Key6,
+	"key7":        m4p.Key7,
+	"key8":        m4p.Key8,
+	"key9":        m4p.Key9,
+	"red":         m4p.KeyRed,
+	"green":       m4p.KeyGreen,
+	"yellow":      m4p.KeyYellow,
+	"blue":        m4p.KeyBlue,
+	"stop":        m4p.KeyStop,
+	"play":        m4p.KeyPlay,
+	"guide":       m4p.KeyGuide,
+	"back":        m4p.KeyBack,
+}
+
+// parseKeyCode accepts a decimal keycode or one of keyNames.
+func parseKeyCode(s string) (int, error) {
+	if code, ok := keyNames[strings.ToLower(s)]; ok {
+		return code, nil
+	}
+	code, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("unknown key %q", s)
+	}
+	return code, nil
+}
+
+// Action performed when a remote key is pressed. Exactly one field is set.
+type Action struct {
+	// Key is held for as long as the remote key, by X keysym name.
+	Key string `json:"key,omitempty"`
+	// Chord keys are pressed in order and released in reverse order.
+	Chord []string `json:"chord,omitempty"`
+	// Button is a mouse button held for as long as the remote key.
+	Button string `json:"button,omitempty"`
+	// Scroll the wheel by this many notches on press, up when positive.
+	Scroll int `json:"scroll,omitempty"`
+	// Command is run on press, argv style without a shell.
+	Command []string `json:"command,omitempty"`
+	// Shell is a script run on press by the system shell.
+	Shell string `json:"shell,omitempty"`
+	// DBus is a method call made on press.
+	DBus *DBusCall `json:"dbus,omitempty"`
+	// Timeout stops a command, shell script or D-Bus call that runs
+	// longer. Commands run until they exit by default.
+	Timeout duration `json:"timeout,omitempty"`
+	// Builtin is one of builtinActions.
+	Builtin string `json:"builtin,omitempty"`
+	// Macro steps run in order on press, in the background.
+	Macro []MacroStep `json:"macro,omitempty"`
+	// Backend runs the macro through another input backend than the
+	// active one, e.g. ydotool to reach gamescope.
+	Backend string `json:"backend,omitempty"`
+
+	// LongPress runs instead when the key is held past the long-press time,
+	// the action itself is then tapped on release.
+	LongPress *Action `json:"longPress,omitempty"`
+	// DoubleTap runs instead when the key is tapped twice in a row, the
+	// action itself is then tapped once no second tap follows.
+	DoubleTap *Action `json:"doubleTap,omitempty"`
+	// Repeat taps the action again and again while the key is held.
+	Repeat bool `json:"repeat,omitempty"`
+}
+
+// builtinActions are the actions implemented in code.
+var builtinActions = map[string]func(s InputSink, pressed bool){
+	"none": func(InputSink, bool) {},
+	// Steam menu (Ctrl+1) and quick access menu (Ctrl+2) in gamescope.
+	"steam-menu": func(s InputSink, pressed bool) {
+		if pressed {
+			steamShortcut(s, "1")
+		}
+	},
+	"steam-qam": func(s InputSink, pressed bool) {
+		if pressed {
+			steamShortcut(s, "2")
+		}
+	},
+}
+
+func (a Action) validate() error {
+	n := 0
+	for _, set := range []bool{a.Key != "", len(a.Chord) > 0, a.Button != "", a.Scroll != 0, len(a.Command) > 0, a.Shell != "", a.DBus != nil, a.Builtin != "", len(a.Macro) > 0} {
+		if set {
+			n++
+		}
+	}
+	if n != 1 {
+		return fmt.Errorf("action must set exactly one of key, chord, button, scroll, command, shell, dbus, builtin or macro")
+	}
+	if a.Timeout != 0 && len(a.Command) == 0 && a.Shell == "" && a.DBus == nil {
+		return fmt.Errorf("timeout is only used with command, shell or dbus")
+	}
+	if a.Timeout < 0 {
+		return fmt.Errorf("timeout must not be negative")
+	}
+	if a.DBus != nil {
+		if err := a.DBus.validate(); err != nil {
+			return err
+		}
+	}
+	if a.Backend != "" && len(a.Macro) == 0 {
+		return fmt.Errorf("backend is only used with macro")
+	}
+	if err := validateMacro(a.Macro, a.Backend); err != nil {
+		return err
+	}
+	if a.Builtin != "" {
+		_, ok := builtinActions[a.Builtin]
+		_, handlerOK := handlerBuiltins[a.Builtin]
+		if _, held := heldBuiltins[a.Builtin]; !ok && !handlerOK && !held {
+			return fmt.Errorf("unknown builtin %q", a.Builtin)
+		}
+	}
+	if a.Repeat && (a.LongPress != nil || a.DoubleTap != nil) {
+		return fmt.Errorf("repeat can't be combined with longPress or doubleTap")
+	}
+	for name, g := range map[string]*Action{"longPress": a.LongPress, "doubleTap": a.DoubleTap} {
+		if g == nil {
+			continue
+		}
+		if g.LongPress != nil || g.DoubleTap != nil || g.Repeat {
+			return fmt.Errorf("%s: gestures can't be nested", name)
+		}
+		if err := g.validate(); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// run presses or releases the action, env is what triggered it.
+func (a Action) run(s InputSink, pressed bool, env actionEnv) {
+	switch {
+	case a.Key != "":
+		s.Key(a.Key, pressed)
+	case len(a.Chord) > 0:
+		if pressed {
+			for _, k := range a.Chord {
+				s.Key(k, true)
+			}
+		} else {
+			for i := len(a.Chord) - 1; i >= 0; i-- {
+				s.Key(a.Chord[i], false)
+			}
+		}
+	case a.Button != "":
+		s.Click(a.Button, pressed)
+	case a.Scroll != 0:
+		if !pressed {
+			return
+		}
+		s.Scroll(0, a.Scroll)
+	case len(a.Command) > 0:
+		if !pressed {
+			return
+		}
+		startCommand(a.Command, env, time.Duration(a.Timeout))
+	case a.Shell != "":
+		if pressed {
+			startCommand(shellCommand(a.Shell), env, time.Duration(a.Timeout))
+		}
+	case a.DBus != nil:
+		if pressed {
+			a.DBus.start(env, time.Duration(a.Timeout))
+		}
+	case a.Builtin != "":
+		fn, ok := builtinActions[a.Builtin]
+		if !ok {
+			log.Printf("unknown builtin %q", a.Builtin)
+			return
+		}
+		fn(s, pressed)
+	case len(a.Macro) > 0:
+		if pressed {
+			startMacro(s, a.Macro, a.Backend)
+		}
+	}
+}
+
+// Mapping from remote keycodes to actions.
+type Mapping struct {
+	// Keys by keycode or name, see keyNames.
+	Keys map[string]Action `json:"keys"`
+	// ASCII forwards unmapped printable ASCII keycodes as keys.
+	ASCII   *bool         `json:"ascii,omitempty"`
+	Pointer PointerConfig `json:"pointer"`
+	// Gestures holds the long-press, double-tap, repeat and combo timing.
+	Gestures GestureConfig `json:"gestures"`
+	// Combos are actions for keys pressed together.
+	Combos []Combo `json:"combos,omitempty"`
+	// MPRIS selects the player of the media builtins.
+	MPRIS MPRISConfig `json:"mpris"`
+	// Controls holds the steps of the volume and brightness builtins.
+	Controls ControlsConfig `json:"controls"`
+	// TextEntry sets up text entry mode.
+	TextEntry TextEntryConfig `json:"textEntry"`
+	// Profiles in order of precedence, the first matching one is used.
+	Profiles []Profile `json:"profiles,omitempty"`
+
+	actions map[int]Action
+}
+
+// defaultMapping is the built-in layout, files are applied on top of it.
+func defaultMapping() *Mapping {
+	ascii := true
+	return &Mapping{
+		Keys: map[string]Action{
+			"left":        {Key: "Left"},
+			"up":          {Key: "Up"},
+			"right":       {Key: "Right"},
+			"down":        {Key: "Down"},
+			"play":        {Builtin: "media-play"},
+			"stop":        {Builtin: "media-stop"},
+			"pause":       {Builtin: "media-pause"},
+			"green":       {Key: "Escape"},
+			"channelup":   {Key: "Prior"},
+			"channeldown": {Key: "Next"},
+			"blue":        {Button: "right"},
+			"wheel":       {Key: "Return"},
+			"guide":       {Button: "right"},
+		},
+		ASCII: &ascii,
+		TextEntry: TextEntryConfig{
+			Keys: map[string]Action{
+				"back": {Key: "BackSpace"},
+				"red":  {Builtin: "text-shift"},
+			},
+		},
+		Profiles: defaultProfiles(),
+	}
+}
+
+// loadMapping reads a mapping file and applies it to the default mapping.
+// An empty path returns the default mapping.
+func loadMapping(path string) (*Mapping, error) {
+	m := defaultMapping()
+	if err := m.resolve(); err != nil {
+		return nil, err
+	}
+	if path == "" {
+		return m, nil
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file Mapping
+	if err := json.Unmarshal(b, &file); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := file.resolve(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	m.merge(&file)
+	return m, nil
+}
+
+// merge applies the actions and settings of o on top of m. Profiles of o
+// with a known name are merged into it, new profiles take precedence over
+// the existing ones.
+func (m *Mapping) merge(o *Mapping) {
+	for code, a := range o.actions {
+		m.actions[code] = a
+	}
+	if o.ASCII != nil {
+		m.ASCII = o.ASCII
+	}
+	m.Pointer = m.Pointer.merge(o.Pointer)
+	m.Gestures = m.Gestures.merge(o.Gestures)
+	m.Combos = append(m.Combos, o.Combos...)
+	m.MPRIS = m.MPRIS.merge(o.MPRIS)
+	m.Controls = m.Controls.merge(o.Controls)
+	m.TextEntry.merge(&o.TextEntry)
+
+	var added []Profile
+next:
+	for _, op := range o.Profiles {
+		for i := range m.Profiles {
+			if m.Profiles[i].Name == op.Name {
+				m.Profiles[i].merge(&op)
+				continue next
+			}
+		}
+		added = append(added, op)
+	}
+	m.Profiles = append(added, m.Profiles...)
+}
+
+// resolve validates the actions and indexes them by keycode.
+func (m *Mapping) resolve() error {
+	actions, err := resolveKeys(m.Keys)
+	if err != nil {
+		return err
+	}
+	m.actions = actions
+	if err := m.Pointer.validate(); err != nil {
+		return err
+	}
+	if err := m.Gestures.validate(); err != nil {
+		return err
+	}
+	if err := m.Controls.validate(); err != nil {
+		return err
+	}
+	if err := m.TextEntry.resolve(); err != nil {
+		return err
+	}
+	for i := range m.Combos {
+		if err := m.Combos[i].resolve(); err != nil {
+			return err
+		}
+	}
+
+	names := make(map[string]bool, len(m.Profiles))
+	for i := range m.Profiles {
+		p := &m.Profiles[i]
+		if names[p.Name] {
+			return fmt.Errorf("duplicate profile %s", p.Name)
+		}
+		names[p.Name] = true
+		if err := p.resolve(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveKeys validates the actions and indexes them by keycode.
+func resolveKeys(keys map[string]Action) (map[int]Action, error) {
+	actions := make(map[int]Action, len(keys))
+	names := make(map[int]string, len(keys))
+	for k, a := range keys {
+		code, err := parseKeyCode(k)
+		if err != nil {
+			return nil, err
+		}
+		if other, ok := names[code]; ok {
+			return nil, fmt.Errorf("keys %s and %s are both keycode %d", other, k, code)
+		}
+		if err := a.validate(); err != nil {
+			return nil, fmt.Errorf("key %s: %w", k, err)
+		}
+		names[code] = k
+		actions[code] = a
+	}
+	return actions, nil
+}
+
+// action returns the action for a keycode in profile p.
+func (m *Mapping) action(p *Profile, code int) (Action, bool) {
+	if a, ok := p.actions[code]; ok {
+		return a, true
+	}
+	if a, ok := m.actions[code]; ok {
+		return a, true
+	}
+	ascii := m.ASCII
+	if p.ASCII != nil {
+		ascii = p.ASCII
+	}
+	if ascii != nil && *ascii && code >= 32 && code < 127 {
+		// ASCII range — send as character. Letter keys arrive as their
+		// upper case key codes, 65-90, and type lower case.
+		r := rune(code)
+		if r >= 'A' && r <= 'Z' {
+			r = unicode.ToLower(r)
+		}
+		key, shift := keyForRune(r)
+		if shift {
+			return Action{Chord: []string{"shift", key}}, true
+		}
+		return Action{Key: key}, true
+	}
+	return Action{}, false
+}
+
+// pointer returns the pointer settings for profile p.
+func (m *Mapping) pointer(p *Profile) PointerConfig {
+	return m.Pointer.merge(p.Pointer)
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
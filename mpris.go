@@ -0,0 +1,375 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	mprisPrefix = "org.mpris.MediaPlayer2."
+	mprisPath   = "/org/mpris/MediaPlayer2"
+	// mprisTimeout bounds every D-Bus call made for a media key.
+	mprisTimeout = 2 * time.Second
+)
+
+// MPRISConfig selects the media player the media builtins control.
+type MPRISConfig struct {
+	// Players in order of preference, by the end of their bus name, e.g.
+	// "vlc" or "firefox". Other players follow, playing ones first.
+	Players []string `json:"players,omitempty"`
+}
+
+func (c MPRISConfig) merge(o MPRISConfig) MPRISConfig {
+	if len(o.Players) > 0 {
+		c.Players = o.Players
+	}
+	return c
+}
+
+// mprisCommand is a method of the MPRIS Player interface and the keysym
+// sent instead when no player is running.
+type mprisCommand struct {
+	method string
+	keysym string
+}
+
+// mprisCommands are the media builtins.
+var mprisCommands = map[string]mprisCommand{
+	"media-play":       {"Play", "XF86AudioPlay"},
+	"media-pause":      {"Pause", "XF86AudioPause"},
+	"media-play-pause": {"PlayPause", "XF86AudioPlay"},
+	"media-stop":       {"Stop", "XF86AudioStop"},
+	"media-next":       {"Next", "XF86AudioNext"},
+	"media-previous":   {"Previous", "XF86AudioPrev"},
+}
+
+func init() {
+	for name, c := range mprisCommands {
+		c := c
+		handlerBuiltins[name] = func(h *handler) {
+			go mpris(h.sink, h.mapping.MPRIS, c)
+		}
+	}
+}
+
+// mpris sends c to the preferred player, or taps its keysym when there is
+// none.
+func mpris(s InputSink, cfg MPRISConfig, c mprisCommand) {
+	player := mprisPlayer(cfg)
+	if player == "" {
+		debugf("mpris: no player, sending %s", c.keysym)
+		s.Key(c.keysym, true)
+		s.Key(c.keysym, false)
+		return
+	}
+	debugf("mpris: %s %s", player, c.method)
+	call := DBusCall{Dest: player, Path: mprisPath, Method: mprisPrefix + "Player." + c.method}
+	if _, err := call.output(mprisTimeout); err != nil {
+		log.Printf("mpris: %s %s: %v", player, c.method, err)
+	}
+}
+
+// mprisPlayer returns the bus name of the player to control, or "" if no
+// player is running or the session bus can't be reached. The players are
+// looked up once and then followed with dbus-monitor, asking every player
+// for its status on each press only when dbus-monitor isn't available.
+func mprisPlayer(cfg MPRISConfig) string {
+	if statuses, ok := mprisPlayers.get(); ok {
+		players := make([]string, 0, len(statuses))
+		for p := range statuses {
+			players = append(players, p)
+		}
+		return rankPlayers(cfg, players, func(p string) string { return statuses[p] })
+	}
+
+	players, err := listPlayers()
+	if err != nil {
+		debugf("mpris: list players: %v", err)
+		return ""
+	}
+	return rankPlayers(cfg, players, playbackStatus)
+}
+
+// rankPlayers returns the first configured player that is running, or else
+// the one whose status ranks best.
+func rankPlayers(cfg MPRISConfig, players []string, status func(player string) string) string {
+	if len(players) == 0 {
+		return ""
+	}
+	sort.Strings(players)
+
+	for _, want := range cfg.Players {
+		for _, p := range players {
+			id := strings.TrimPrefix(p, mprisPrefix)
+			if id == want || strings.HasPrefix(id, want+".") {
+				return p
+			}
+		}
+	}
+
+	// Playing before paused before stopped.
+	rank := map[string]int{"Playing": 0, "Paused": 1}
+	best, bestRank := players[0], len(rank)
+	for _, p := range players {
+		r, ok := rank[status(p)]
+		if !ok {
+			r = len(rank)
+		}
+		if r < bestRank {
+			best, bestRank = p, r
+		}
+	}
+	return best
+}
+
+// listPlayers returns the bus names of the running players.
+func listPlayers() ([]string, error) {
+	list := DBusCall{Dest: "org.freedesktop.DBus", Path: "/org/freedesktop/DBus", Method: "org.freedesktop.DBus.ListNames"}
+	out, err := list.output(mprisTimeout)
+	if err != nil {
+		return nil, err
+	}
+	var players []string
+	for _, name := range dbusStrings(out) {
+		if strings.HasPrefix(name, mprisPrefix) {
+			players = append(players, name)
+		}
+	}
+	return players, nil
+}
+
+// playbackStatus asks a player whether it is Playing, Paused or Stopped, it
+// returns "" on errors.
+func playbackStatus(player string) string {
+	get := DBusCall{
+		Dest:   player,
+		Path:   mprisPath,
+		Method: "org.freedesktop.DBus.Properties.Get",
+		Args:   []string{"string:" + mprisPrefix + "Player", "string:PlaybackStatus"},
+	}
+	out, err := get.output(mprisTimeout)
+	if err != nil {
+		return ""
+	}
+	if status := dbusStrings(out); len(status) > 0 {
+		return status[0]
+	}
+	return ""
+}
+
+// nameOwner returns the unique name owning a bus name, e.g. ":1.42".
+func nameOwner(name string) (string, error) {
+	get := DBusCall{
+		Dest:   "org.freedesktop.DBus",
+		Path:   "/org/freedesktop/DBus",
+		Method: "org.freedesktop.DBus.GetNameOwner",
+		Args:   []string{"string:" + name},
+	}
+	out, err := get.output(mprisTimeout)
+	if err != nil {
+		return "", err
+	}
+	if owner := dbusStrings(out); len(owner) > 0 {
+		return owner[0], nil
+	}
+	return "", fmt.Errorf("no owner in reply: %q", out)
+}
+
+// mprisPlayers follows the running players for the media builtins.
+var mprisPlayers mprisWatcher
+
+// mprisWatcher keeps the running players and their playback status up to
+// date from a dbus-monitor watching players come and go and change state.
+// dbus-monitor runs from the first media key until this process exits,
+// when it dies writing to the closed pipe.
+type mprisWatcher struct {
+	mu sync.Mutex
+	// started is set while dbus-monitor runs, live once the players were
+	// looked up and the watcher can answer for them.
+	started bool
+	live    bool
+	// owners maps player bus names to the unique names owning them, which
+	// send the PropertiesChanged signals.
+	owners map[string]string
+	// status is the PlaybackStatus by unique name.
+	status map[string]string
+}
+
+// mprisMatchRules select the signals the watcher needs.
+var mprisMatchRules = []string{
+	"type='signal',sender='org.freedesktop.DBus',member='NameOwnerChanged',arg0namespace='org.mpris.MediaPlayer2'",
+	"type='signal',interface='org.freedesktop.DBus.Properties',member='PropertiesChanged',path='" + mprisPath + "'",
+}
+
+// get returns the running players and their status, ok is false until the
+// watcher is live. The first call starts dbus-monitor, as does the next one
+// after dbus-monitor exited.
+func (w *mprisWatcher) get() (statuses map[string]string, ok bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.started {
+		w.started = true
+		go w.run()
+		return nil, false
+	}
+	if !w.live {
+		return nil, false
+	}
+	statuses = make(map[string]string, len(w.owners))
+	for p, owner := range w.owners {
+		statuses[p] = w.status[owner]
+	}
+	return statuses, true
+}
+
+// run starts dbus-monitor and follows its output until it exits.
+func (w *mprisWatcher) run() {
+	defer func() {
+		w.mu.Lock()
+		w.started, w.live = false, false
+		w.mu.Unlock()
+	}()
+
+	cmd := exec.Command("dbus-monitor", append([]string{"--session"}, mprisMatchRules...)...)
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		debugf("mpris: dbus-monitor: %v", err)
+		return
+	}
+	if err := cmd.Start(); err != nil {
+		debugf("mpris: dbus-monitor: %v", err)
+		return
+	}
+	w.read(out, func() {
+		// The monitor is subscribed, changes from now on aren't missed.
+		go w.load()
+	})
+	err = cmd.Wait()
+	debugf("mpris: dbus-monitor exited: %v", err)
+}
+
+// load looks up the running players and their status, keeping what the
+// monitor reported in the meantime.
+func (w *mprisWatcher) load() {
+	players, err := listPlayers()
+	if err != nil {
+		debugf("mpris: list players: %v", err)
+		return
+	}
+	owners := make(map[string]string)
+	status := make(map[string]string)
+	for _, p := range players {
+		owner, err := nameOwner(p)
+		if err != nil {
+			continue
+		}
+		owners[p] = owner
+		status[owner] = playbackStatus(p)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.started {
+		return
+	}
+	for p, owner := range owners {
+		if _, ok := w.owners[p]; !ok {
+			w.owners[p] = owner
+		}
+	}
+	for owner, s := range status {
+		if _, ok := w.status[owner]; !ok {
+			w.status[owner] = s
+		}
+	}
+	w.live = true
+}
+
+var dbusMonitorHeaderRe = regexp.MustCompile(`^\w+ .*\bsender=(\S+) .*\bmember=(\w+)`)
+
+// read applies the signals in dbus-monitor output to the watcher, calling
+// subscribed once the monitor announced itself.
+func (w *mprisWatcher) read(r io.Reader, subscribed func()) {
+	w.mu.Lock()
+	w.owners = make(map[string]string)
+	w.status = make(map[string]string)
+	w.mu.Unlock()
+
+	var (
+		sender, member string
+		args           []string
+		announced      bool
+	)
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := sc.Text()
+		if !strings.HasPrefix(line, " ") {
+			// A new message, its arguments follow indented.
+			sender, member, args = "", "", nil
+			if m := dbusMonitorHeaderRe.FindStringSubmatch(line); m != nil {
+				sender, member = m[1], m[2]
+			}
+			if !announced && member == "NameAcquired" {
+				announced = true
+				subscribed()
+			}
+			continue
+		}
+
+		strs := dbusStrings(line)
+		switch member {
+		case "NameOwnerChanged":
+			// name, old owner, new owner.
+			args = append(args, strs...)
+			if len(args) == 3 {
+				w.nameOwnerChanged(args[0], args[1], args[2])
+			}
+		case "PropertiesChanged":
+			// Changed properties are a key line followed by a variant line.
+			if len(strs) == 0 {
+				continue
+			}
+			if strings.Contains(line, "variant") {
+				if len(args) > 0 && args[len(args)-1] == "PlaybackStatus" {
+					w.mu.Lock()
+					w.status[sender] = strs[0]
+					w.mu.Unlock()
+				}
+				continue
+			}
+			args = append(args, strs[0])
+		}
+	}
+}
+
+func (w *mprisWatcher) nameOwnerChanged(name, oldOwner, newOwner string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if oldOwner != "" {
+		delete(w.status, oldOwner)
+	}
+	if newOwner == "" {
+		delete(w.owners, name)
+	} else {
+		w.owners[name] = newOwner
+	}
+}
+
+var dbusStringRe = regexp.MustCompile(`(?m)string "((?:[^"\\]|\\.)*)"`)
+
+// dbusStrings returns the strings in a dbus-send --print-reply output.
+func dbusStrings(out string) []string {
+	var s []string
+	for _, m := range dbusStringRe.FindAllStringSubmatch(out, -1) {
+		s = append(s, m[1])
+	}
+	return s
+}
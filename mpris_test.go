@@ -0,0 +1,115 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// dbusMonitorOutput is dbus-monitor output for the MPRIS match rules: the
+// monitor announcing itself, vlc and firefox starting, vlc playing, firefox
+// pausing and quitting.
+const dbusMonitorOutput = `signal time=1.1 sender=org.freedesktop.DBus -> destination=:1.0 serial=2 path=/org/freedesktop/DBus; interface=org.freedesktop.DBus; member=NameAcquired
+   string ":1.0"
+signal time=1.2 sender=org.freedesktop.DBus -> destination=:1.0 serial=4 path=/org/freedesktop/DBus; interface=org.freedesktop.DBus; member=NameLost
+   string ":1.0"
+signal time=1.3 sender=org.freedesktop.DBus -> destination=(null destination) serial=5 path=/org/freedesktop/DBus; interface=org.freedesktop.DBus; member=NameOwnerChanged
+   string "org.mpris.MediaPlayer2.vlc"
+   string ""
+   string ":1.5"
+signal time=1.4 sender=org.freedesktop.DBus -> destination=(null destination) serial=6 path=/org/freedesktop/DBus; interface=org.freedesktop.DBus; member=NameOwnerChanged
+   string "org.mpris.MediaPlayer2.firefox.instance_1"
+   string ""
+   string ":1.6"
+signal time=1.5 sender=:1.5 -> destination=(null destination) serial=7 path=/org/mpris/MediaPlayer2; interface=org.freedesktop.DBus.Properties; member=PropertiesChanged
+   string "org.mpris.MediaPlayer2.Player"
+   array [
+      dict entry(
+         string "Metadata"
+         variant             array [
+               dict entry(
+                  string "xesam:title"
+                  variant                      string "PlaybackStatus"
+               )
+            ]
+      )
+      dict entry(
+         string "PlaybackStatus"
+         variant             string "Playing"
+      )
+   ]
+   array [
+   ]
+signal time=1.6 sender=:1.6 -> destination=(null destination) serial=8 path=/org/mpris/MediaPlayer2; interface=org.freedesktop.DBus.Properties; member=PropertiesChanged
+   string "org.mpris.MediaPlayer2.Player"
+   array [
+      dict entry(
+         string "PlaybackStatus"
+         variant             string "Paused"
+      )
+   ]
+   array [
+   ]
+signal time=1.7 sender=org.freedesktop.DBus -> destination=(null destination) serial=9 path=/org/freedesktop/DBus; interface=org.freedesktop.DBus; member=NameOwnerChanged
+   string "org.mpris.MediaPlayer2.firefox.instance_1"
+   string ":1.6"
+   string ""
+`
+
+func TestMPRISWatcherRead(t *testing.T) {
+	var w mprisWatcher
+	subscribed := 0
+	w.read(strings.NewReader(dbusMonitorOutput), func() { subscribed++ })
+	if subscribed != 1 {
+		t.Errorf("subscribed called %d times, want 1", subscribed)
+	}
+	if want := map[string]string{"org.mpris.MediaPlayer2.vlc": ":1.5"}; !reflect.DeepEqual(w.owners, want) {
+		t.Errorf("owners = %v, want %v", w.owners, want)
+	}
+	if want := map[string]string{":1.5": "Playing"}; !reflect.DeepEqual(w.status, want) {
+		t.Errorf("status = %v, want %v", w.status, want)
+	}
+}
+
+func TestRankPlayers(t *testing.T) {
+	status := map[string]string{
+		"org.mpris.MediaPlayer2.vlc":                "Paused",
+		"org.mpris.MediaPlayer2.firefox.instance_1": "Playing",
+		"org.mpris.MediaPlayer2.mpv":                "Stopped",
+	}
+	var players []string
+	for p := range status {
+		players = append(players, p)
+	}
+	for _, tt := range []struct {
+		prefer []string
+		want   string
+		// ranked is set when the status of every player is needed.
+		ranked bool
+	}{
+		{nil, "org.mpris.MediaPlayer2.firefox.instance_1", true},
+		{[]string{"vlc"}, "org.mpris.MediaPlayer2.vlc", false},
+		{[]string{"firefox"}, "org.mpris.MediaPlayer2.firefox.instance_1", false},
+		{[]string{"spotify", "mpv"}, "org.mpris.MediaPlayer2.mpv", false},
+		{[]string{"spotify"}, "org.mpris.MediaPlayer2.firefox.instance_1", true},
+	} {
+		asked := 0
+		got := rankPlayers(MPRISConfig{Players: tt.prefer}, players, func(p string) string {
+			asked++
+			return status[p]
+		})
+		if got != tt.want {
+			t.Errorf("rankPlayers(%v) = %q, want %q", tt.prefer, got, tt.want)
+		}
+		want := 0
+		if tt.ranked {
+			want = len(players)
+		}
+		if asked != want {
+			t.Errorf("rankPlayers(%v) asked for %d statuses, want %d", tt.prefer, asked, want)
+		}
+	}
+	if got := rankPlayers(MPRISConfig{}, nil, nil); got != "" {
+		t.Errorf("rankPlayers without players = %q, want \"\"", got)
+	}
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/netham45/magic4pc_altclient/m4p"
+)
+
+// Pointer modes.
+const (
+	// pointerAbsolute follows the pointer the TV draws on screen.
+	pointerAbsolute = "absolute"
+	// pointerGyro integrates the gyroscope rates into relative motion.
+	pointerGyro = "gyro"
+	// pointerQuaternion turns changes of the remote's orientation into
+	// relative motion.
+	pointerQuaternion = "quaternion"
+)
+
+// Air mouse defaults.
+const (
+	defaultSensitivity  = 1000.0 // Pixels per radian.
+	defaultAcceleration = 1.0
+	// airMouseMaxGap is the longest pause between updates that is still
+	// integrated, longer gaps restart the motion.
+	airMouseMaxGap = 500 * time.Millisecond
+)
+
+// PointerConfig controls how the remote drives the pointer. Unset fields
+// inherit from the base mapping.
+type PointerConfig struct {
+	// Disabled ignores pointer motion, e.g. for apps driven by the arrows.
+	Disabled *bool `json:"disabled,omitempty"`
+	// Mode is absolute (default), gyro or quaternion.
+	Mode string `json:"mode,omitempty"`
+	// Sensitivity of the air mouse modes in pixels per radian of rotation.
+	Sensitivity *float64 `json:"sensitivity,omitempty"`
+	// Acceleration is the exponent applied to the rotation speed in rad/s,
+	// 1 is linear, larger values slow down fine movements and speed up
+	// fast ones.
+	Acceleration *float64 `json:"acceleration,omitempty"`
+	InvertX      *bool    `json:"invertX,omitempty"`
+	InvertY      *bool    `json:"invertY,omitempty"`
+	// Filters smooth the pointer motion, applied in order.
+	Filters []FilterConfig `json:"filters,omitempty"`
+	// Scroll controls the wheel.
+	Scroll ScrollConfig `json:"scroll"`
+	// DragLock keeps the left button down after a tap of the wheel button,
+	// shorter than this, until the next tap. Holding it longer drags
+	// normally. Off when unset or 0.
+	DragLock *duration `json:"dragLock,omitempty"`
+	// ClickFreeze moves the pointer back to where it was this long before a
+	// wheel button press or release and holds it still for as long.
+	ClickFreeze *duration `json:"clickFreeze,omitempty"`
+}
+
+// merge returns c with the fields set in o applied on top.
+func (c PointerConfig) merge(o PointerConfig) PointerConfig {
+	if o.Disabled != nil {
+		c.Disabled = o.Disabled
+	}
+	if o.Mode != "" {
+		c.Mode = o.Mode
+	}
+	if o.Sensitivity != nil {
+		c.Sensitivity = o.Sensitivity
+	}
+	if o.Acceleration != nil {
+		c.Acceleration = o.Acceleration
+	}
+	if o.InvertX != nil {
+		c.InvertX = o.InvertX
+	}
+	if o.InvertY != nil {
+		c.InvertY = o.InvertY
+	}
+	if o.Filters != nil {
+		c.Filters = o.Filters
+	}
+	c.Scroll = c.Scroll.merge(o.Scroll)
+	if o.DragLock != nil {
+		c.DragLock = o.DragLock
+	}
+	if o.ClickFreeze != nil {
+		c.ClickFreeze = o.ClickFreeze
+	}
+	return c
+}
+
+func (c PointerConfig) validate() error {
+	switch c.Mode {
+	case "", pointerAbsolute, pointerGyro, pointerQuaternion:
+	default:
+		return fmt.Errorf("unknown pointer mode %q", c.Mode)
+	}
+	if c.Sensitivity != nil && *c.Sensitivity <= 0 {
+		return fmt.Errorf("pointer sensitivity must be positive")
+	}
+	if c.Acceleration != nil && *c.Acceleration <= 0 {
+		return fmt.Errorf("pointer acceleration must be positive")
+	}
+	for _, f := range c.Filters {
+		if err := f.validate(); err != nil {
+			return err
+		}
+	}
+	if c.dragLock() < 0 || c.clickFreeze() < 0 {
+		return fmt.Errorf("pointer dragLock and clickFreeze must not be negative")
+	}
+	return c.Scroll.validate()
+}
+
+func (c PointerConfig) disabled() bool {
+	return c.Disabled != nil && *c.Disabled
+}
+
+func (c PointerConfig) mode() string {
+	if c.Mode == "" {
+		return pointerAbsolute
+	}
+	return c.Mode
+}
+
+func (c PointerConfig) sensitivity() float64 {
+	if c.Sensitivity == nil {
+		return defaultSensitivity
+	}
+	return *c.Sensitivity
+}
+
+func (c PointerConfig) acceleration() float64 {
+	if c.Acceleration == nil {
+		return defaultAcceleration
+	}
+	return *c.Acceleration
+}
+
+func (c PointerConfig) dragLock() time.Duration {
+	if c.DragLock == nil {
+		return 0
+	}
+	return time.Duration(*c.DragLock)
+}
+
+func (c PointerConfig) clickFreeze() time.Duration {
+	if c.ClickFreeze == nil {
+		return 0
+	}
+	return time.Duration(*c.ClickFreeze)
+}
+
+// airMouse turns remote rotation into relative pointer motion.
+type airMouse struct {
+	last        time.Time
+	yaw, pitch  float64 // Orientation at last, quaternion mode only.
+	initialized bool
+}
+
+// motion returns the pointer motion in pixels since the previous frame.
+func (a *airMouse) motion(f m4p.SensorFrame, c PointerConfig, now time.Time) (dx, dy float64) {
+	dt := now.Sub(a.last).Seconds()
+	restart := !a.initialized || now.Sub(a.last) > airMouseMaxGap
+	a.last = now
+	a.initialized = true
+
+	// Rotation rates in rad/s: yaw turns the pointer sideways, pitch up and
+	// down. The remote's Y axis points at the screen.
+	var yawRate, pitchRate float64
+	switch c.mode() {
+	case pointerGyro:
+		if !f.Has(m4p.FilterGyroscope) {
+			return 0, 0
+		}
+		yawRate = float64(f.Gyroscope.Z)
+		pitchRate = float64(f.Gyroscope.X)
+
+	case pointerQuaternion:
+		if !f.Has(m4p.FilterQuaternion) {
+			return 0, 0
+		}
+		yaw, pitch := orientation(f.Quaternion)
+		dyaw, dpitch := wrapAngle(yaw-a.yaw), wrapAngle(pitch-a.pitch)
+		a.yaw, a.pitch = yaw, pitch
+		if restart || dt <= 0 {
+			break
+		}
+		yawRate = dyaw / dt
+		pitchRate = dpitch / dt
+	}
+	if restart || dt <= 0 {
+		return 0, 0
+	}
+
+	// Turning right is a negative rotation around Z, tilting up a positive
+	// one around X; screen Y grows downwards.
+	vx, vy := -yawRate, -pitchRate
+	if c.InvertX != nil && *c.InvertX {
+		vx = -vx
+	}
+	if c.InvertY != nil && *c.InvertY {
+		vy = -vy
+	}
+
+	// Scale the speed along the acceleration curve, keeping the direction.
+	speed := math.Hypot(vx, vy)
+	if speed == 0 {
+		return 0, 0
+	}
+	gain := c.sensitivity() * math.Pow(speed, c.acceleration()-1)
+
+	return vx * gain * dt, vy * gain * dt
+}
+
+// orientation returns the yaw (around Z) and pitch (around X) angles of q,
+// taking Q0 as the scalar part.
+func orientation(q m4p.Quaternion) (yaw, pitch float64) {
+	w, x, y, z := float64(q.Q0), float64(q.Q1), float64(q.Q2), float64(q.Q3)
+	yaw = math.Atan2(2*(w*z+x*y), 1-2*(y*y+z*z))
+	pitch = math.Atan2(2*(w*x+y*z), 1-2*(x*x+y*y))
+	return yaw, pitch
+}
+
+// wrapAngle maps a to (-π, π].
+func wrapAngle(a float64) float64 {
+	for a > math.Pi {
+		a -= 2 * math.Pi
+	}
+	for a <= -math.Pi {
+		a += 2 * math.Pi
+	}
+	return a
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// profilePollInterval is how often the host is probed for profile changes.
+const profilePollInterval = 2 * time.Second
+
+// profileRecheckInterval is how often key presses may probe the host again.
+const profileRecheckInterval = 250 * time.Millisecond
+
+// ProfileMatch selects a profile from the state of the host. All set fields
+// must match, a profile without rules always matches.
+type ProfileMatch struct {
+	// Process matches when the command line of a running process contains it.
+	Process string `json:"process,omitempty"`
+	// WindowClass matches when the class of the focused window contains it,
+	// ignoring case.
+	WindowClass string `json:"windowClass,omitempty"`
+	// Session matches the session type: x11, wayland, gamescope or windows.
+	Session string `json:"session,omitempty"`
+}
+
+func (pm ProfileMatch) empty() bool {
+	return pm == ProfileMatch{}
+}
+
+func (pm ProfileMatch) match(h hostState) bool {
+	if pm.Process != "" && !h.running(pm.Process) {
+		return false
+	}
+	if pm.WindowClass != "" && !strings.Contains(strings.ToLower(h.windowClass), strings.ToLower(pm.WindowClass)) {
+		return false
+	}
+	if pm.Session != "" && !strings.EqualFold(pm.Session, h.session) {
+		return false
+	}
+	return true
+}
+
+// Profile is a named layout used while its rules match. Its keys and
+// pointer settings apply on top of the base mapping.
+type Profile struct {
+	Name    string            `json:"name"`
+	Match   ProfileMatch      `json:"match"`
+	Keys    map[string]Action `json:"keys,omitempty"`
+	ASCII   *bool             `json:"ascii,omitempty"`
+	Pointer PointerConfig     `json:"pointer"`
+
+	actions map[int]Action
+}
+
+func (p *Profile) resolve() error {
+	if p.Name == "" {
+		return fmt.Errorf("profile without name")
+	}
+	actions, err := resolveKeys(p.Keys)
+	if err != nil {
+		return fmt.Errorf("profile %s: %w", p.Name, err)
+	}
+	p.actions = actions
+	if err := p.Pointer.validate(); err != nil {
+		return fmt.Errorf("profile %s: %w", p.Name, err)
+	}
+	return nil
+}
+
+// merge applies the settings of o, a profile with the same name, on top of p.
+func (p *Profile) merge(o *Profile) {
+	if !o.Match.empty() {
+		p.Match = o.Match
+	}
+	if p.actions == nil {
+		p.actions = make(map[int]Action, len(o.actions))
+	}
+	for code, a := range o.actions {
+		p.actions[code] = a
+	}
+	if o.ASCII != nil {
+		p.ASCII = o.ASCII
+	}
+	p.Pointer = p.Pointer.merge(o.Pointer)
+}
+
+// hostState is a snapshot of what profiles are matched against.
+type hostState struct {
+	processes   []string // Command lines, arguments separated by spaces.
+	windowClass string
+	session     string
+}
+
+func (h hostState) running(s string) bool {
+	for _, p := range h.processes {
+		if strings.Contains(p, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// profileSelector keeps track of the profile matching the host.
+type profileSelector struct {
+	mapping *Mapping
+	// needWindow is set when some profile matches on the focused window,
+	// which is comparatively expensive to probe.
+	needWindow bool
+	// needProbe is set when some profile has rules at all.
+	needProbe bool
+	current   atomic.Value // *Profile
+	// probe inspects the host, probeHost outside of tests.
+	probe func(needWindow bool) hostState
+	// recheck asks run for an update ahead of the next poll.
+	recheck chan struct{}
+}
+
+// baseProfile is used when no profile matches.
+var baseProfile = &Profile{Name: "default"}
+
+func newProfileSelector(m *Mapping) *profileSelector {
+	s := &profileSelector{mapping: m, probe: probeHost, recheck: make(chan struct{}, 1)}
+	for _, p := range m.Profiles {
+		if p.Match.WindowClass != "" {
+			s.needWindow = true
+		}
+		if !p.Match.empty() {
+			s.needProbe = true
+		}
+	}
+	s.current.Store(baseProfile)
+	s.update()
+	return s
+}
+
+// run re-evaluates the profile rules every profilePollInterval, and when
+// asked by poke, until ctx is done.
+func (s *profileSelector) run(ctx context.Context) {
+	t := time.NewTicker(profilePollInterval)
+	defer t.Stop()
+	var last time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		case <-s.recheck:
+			if time.Since(last) < profileRecheckInterval {
+				continue
+			}
+		}
+		s.update()
+		last = time.Now()
+	}
+}
+
+// poke asks for the rules to be checked again without waiting for the next
+// poll. Key presses poke, so a switch, e.g. to gamescope, is picked up by
+// the following keys instead of up to profilePollInterval later.
+func (s *profileSelector) poke() {
+	select {
+	case s.recheck <- struct{}{}:
+	default:
+	}
+}
+
+func (s *profileSelector) update() {
+	if len(s.mapping.Profiles) == 0 {
+		return
+	}
+
+	var h hostState
+	if s.needProbe {
+		h = s.probe(s.needWindow)
+	}
+	p := baseProfile
+	for i := range s.mapping.Profiles {
+		if s.mapping.Profiles[i].Match.match(h) {
+			p = &s.mapping.Profiles[i]
+			break
+		}
+	}
+	if old := s.current.Swap(p).(*Profile); old != p {
+		log.Printf("profile: switched from %s to %s", old.Name, p.Name)
+	}
+}
+
+// profile returns the active profile.
+func (s *profileSelector) profile() *Profile {
+	return s.current.Load().(*Profile)
+}
@@ -0,0 +1,80 @@
+//go:build linux
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// defaultProfiles reproduce the original behaviour: Steam shortcuts in
+// gamescope (Steam Big Picture), desktop keys while KDE is running.
+func defaultProfiles() []Profile {
+	return []Profile{
+		{
+			Name:  "kde-desktop",
+			Match: ProfileMatch{Process: "kwin_wayland"},
+			Keys: map[string]Action{
+				"back":   {Button: "x1"},
+				"red":    {Key: "super"},
+				"yellow": {Button: "middle"},
+			},
+		},
+		{
+			Name: "gamescope",
+			Keys: map[string]Action{
+				"back":   {Key: "Escape"},
+				"red":    {Builtin: "steam-menu"},
+				"yellow": {Builtin: "steam-qam"},
+			},
+		},
+	}
+}
+
+// probeHost inspects /proc for processes and the session type, and asks
+// xdotool for the focused window when needWindow is set.
+func probeHost(needWindow bool) hostState {
+	var h hostState
+	matches, _ := filepath.Glob("/proc/*/cmdline")
+	for _, f := range matches {
+		data, err := os.ReadFile(f)
+		if err != nil || len(data) == 0 {
+			continue
+		}
+		h.processes = append(h.processes, string(bytes.TrimRight(bytes.ReplaceAll(data, []byte{0}, []byte{' '}), " ")))
+	}
+
+	switch {
+	case h.running("gamescope"):
+		h.session = "gamescope"
+	case os.Getenv("XDG_SESSION_TYPE") != "":
+		h.session = os.Getenv("XDG_SESSION_TYPE")
+	case h.running("kwin_wayland"), os.Getenv("WAYLAND_DISPLAY") != "":
+		h.session = "wayland"
+	default:
+		h.session = "x11"
+	}
+
+	if needWindow {
+		h.windowClass = focusedWindowClass()
+	}
+	return h
+}
+
+// focusedWindowClass returns the class of the focused X (or Xwayland) window.
+func focusedWindowClass() string {
+	disp, xauth := getXDisplay()
+	if disp == "" {
+		disp = ":0"
+	}
+	cmd := exec.Command("/usr/bin/xdotool", "getactivewindow", "getwindowclassname")
+	cmd.Env = append(os.Environ(), "DISPLAY="+disp, "XAUTHORITY="+xauth)
+	out, err := cmd.Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
@@ -0,0 +1,79 @@
+package main
+
+import "testing"
+
+func TestProfileMatch(t *testing.T) {
+	host := hostState{
+		processes:   []string{"/usr/bin/kwin_wayland --xwayland", "steam -gamepadui"},
+		windowClass: "Kodi",
+		session:     "wayland",
+	}
+	for _, tt := range []struct {
+		match ProfileMatch
+		want  bool
+	}{
+		{ProfileMatch{}, true},
+		{ProfileMatch{Process: "kwin_wayland"}, true},
+		{ProfileMatch{Process: "gamepadui"}, true},
+		{ProfileMatch{Process: "gamescope"}, false},
+		{ProfileMatch{WindowClass: "kodi"}, true},
+		{ProfileMatch{WindowClass: "firefox"}, false},
+		{ProfileMatch{Session: "Wayland"}, true},
+		{ProfileMatch{Session: "x11"}, false},
+		{ProfileMatch{Process: "steam", WindowClass: "kodi", Session: "wayland"}, true},
+		{ProfileMatch{Process: "steam", Session: "gamescope"}, false},
+	} {
+		if got := tt.match.match(host); got != tt.want {
+			t.Errorf("%+v.match() = %v, want %v", tt.match, got, tt.want)
+		}
+	}
+}
+
+func TestProfileSelector(t *testing.T) {
+	m := &Mapping{Profiles: []Profile{
+		{Name: "kodi", Match: ProfileMatch{WindowClass: "kodi"}},
+		{Name: "gamescope", Match: ProfileMatch{Session: "gamescope"}},
+		{Name: "steam", Match: ProfileMatch{Process: "steam"}},
+	}}
+	s := newProfileSelector(m)
+	if !s.needProbe || !s.needWindow {
+		t.Errorf("needProbe, needWindow = %v, %v, want both set", s.needProbe, s.needWindow)
+	}
+
+	var host hostState
+	s.probe = func(needWindow bool) hostState {
+		if !needWindow {
+			t.Error("probed without the focused window")
+		}
+		return host
+	}
+	for _, tt := range []struct {
+		host hostState
+		want string
+	}{
+		{hostState{session: "x11"}, "default"},
+		{hostState{session: "gamescope", processes: []string{"steam"}}, "gamescope"},
+		// The first matching profile wins.
+		{hostState{session: "gamescope", windowClass: "kodi"}, "kodi"},
+		{hostState{session: "wayland", processes: []string{"steam"}}, "steam"},
+		{hostState{session: "wayland"}, "default"},
+	} {
+		host = tt.host
+		s.update()
+		if got := s.profile().Name; got != tt.want {
+			t.Errorf("profile for %+v = %s, want %s", tt.host, got, tt.want)
+		}
+	}
+}
+
+func TestProfileSelectorWithoutRules(t *testing.T) {
+	s := newProfileSelector(&Mapping{Profiles: []Profile{{Name: "always"}}})
+	s.probe = func(bool) hostState {
+		t.Error("probed the host without rules to match")
+		return hostState{}
+	}
+	s.update()
+	if got := s.profile().Name; got != "always" {
+		t.Errorf("profile = %s, want always", got)
+	}
+}
@@ -0,0 +1,69 @@
+//go:build windows
+
+package main
+
+import (
+	"encoding/csv"
+	"os/exec"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// defaultProfiles keep the original Windows layout: browser back, the Win
+// key and middle click.
+func defaultProfiles() []Profile {
+	return []Profile{
+		{
+			Name: "desktop",
+			Keys: map[string]Action{
+				"back":   {Button: "x1"},
+				"red":    {Key: "super"},
+				"yellow": {Button: "middle"},
+			},
+		},
+	}
+}
+
+// createNoWindow is the CREATE_NO_WINDOW process creation flag.
+const createNoWindow = 0x08000000
+
+var (
+	user32                  = syscall.NewLazyDLL("user32.dll")
+	procGetForegroundWindow = user32.NewProc("GetForegroundWindow")
+	procGetClassNameW       = user32.NewProc("GetClassNameW")
+)
+
+// probeHost lists processes with tasklist and, when needWindow is set, reads
+// the class of the foreground window.
+func probeHost(needWindow bool) hostState {
+	h := hostState{session: "windows"}
+
+	cmd := exec.Command("tasklist", "/fo", "csv", "/nh")
+	// Don't flash a console window from the windowsgui build.
+	cmd.SysProcAttr = &syscall.SysProcAttr{HideWindow: true, CreationFlags: createNoWindow}
+	out, err := cmd.Output()
+	if err == nil {
+		records, _ := csv.NewReader(strings.NewReader(string(out))).ReadAll()
+		for _, r := range records {
+			if len(r) > 0 {
+				h.processes = append(h.processes, r[0])
+			}
+		}
+	}
+
+	if needWindow {
+		h.windowClass = foregroundWindowClass()
+	}
+	return h
+}
+
+func foregroundWindowClass() string {
+	hwnd, _, _ := procGetForegroundWindow.Call()
+	if hwnd == 0 {
+		return ""
+	}
+	var buf [256]uint16
+	n, _, _ := procGetClassNameW.Call(hwnd, uintptr(unsafe.Pointer(&buf[0])), uintptr(len(buf)))
+	return syscall.UTF16ToString(buf[:n])
+}
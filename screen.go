@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"regexp"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// screenPollInterval is how often the monitor layout is re-read, so the
+// mapping follows monitors being plugged in or rearranged.
+const screenPollInterval = 10 * time.Second
+
+// rect is an area of the desktop in pixels.
+type rect struct {
+	X, Y, W, H int
+}
+
+func (r rect) empty() bool {
+	return r.W <= 0 || r.H <= 0
+}
+
+// String formats r as an X geometry, WxH+X+Y.
+func (r rect) String() string {
+	return fmt.Sprintf("%dx%d%+d%+d", r.W, r.H, r.X, r.Y)
+}
+
+// union returns the smallest rect containing r and o.
+func (r rect) union(o rect) rect {
+	if r.empty() {
+		return o
+	}
+	x0, y0 := minInt(r.X, o.X), minInt(r.Y, o.Y)
+	x1, y1 := maxInt(r.X+r.W, o.X+o.W), maxInt(r.Y+r.H, o.Y+o.H)
+	return rect{X: x0, Y: y0, W: x1 - x0, H: y1 - y0}
+}
+
+// letterbox returns the largest area of r with the TV's aspect ratio,
+// centered in r.
+func (r rect) letterbox() rect {
+	w, h := r.W, r.H
+	if float64(w)/float64(h) > tvWidth/tvHeight {
+		w = int(math.Round(float64(h) * tvWidth / tvHeight))
+	} else {
+		h = int(math.Round(float64(w) * tvHeight / tvWidth))
+	}
+	return rect{X: r.X + (r.W-w)/2, Y: r.Y + (r.H-h)/2, W: w, H: h}
+}
+
+var geometryRe = regexp.MustCompile(`^(\d+)x(\d+)([+-]\d+)([+-]\d+)$`)
+
+// parseGeometry parses an X geometry, WxH+X+Y.
+func parseGeometry(s string) (rect, bool) {
+	m := geometryRe.FindStringSubmatch(s)
+	if m == nil {
+		return rect{}, false
+	}
+	var r rect
+	r.W, _ = strconv.Atoi(m[1])
+	r.H, _ = strconv.Atoi(m[2])
+	r.X, _ = strconv.Atoi(m[3])
+	r.Y, _ = strconv.Atoi(m[4])
+	return r, !r.empty()
+}
+
+// screenOutput is a monitor and where it sits on the desktop.
+type screenOutput struct {
+	name   string
+	bounds rect
+}
+
+// OutputConfig selects the part of the desktop the TV's pointer covers.
+type OutputConfig struct {
+	// Name is a monitor name (e.g. HDMI-1), its index in the monitor list,
+	// or a WxH+X+Y rectangle. Empty covers the whole desktop.
+	Name string `json:"name,omitempty"`
+	// OffsetX and OffsetY shift the pointer by this many pixels.
+	OffsetX int `json:"offsetX,omitempty"`
+	OffsetY int `json:"offsetY,omitempty"`
+	// Letterbox keeps the TV's 16:9 aspect ratio instead of stretching it
+	// over the target, leaving bars on the sides or at the top and bottom.
+	Letterbox bool `json:"letterbox,omitempty"`
+}
+
+// screenMapper maps TV coordinates onto the desktop.
+type screenMapper struct {
+	config OutputConfig
+	// fixed is set when the target is a rectangle rather than a monitor.
+	fixed  bool
+	target atomic.Value // rect
+}
+
+func newScreenMapper(c OutputConfig) *screenMapper {
+	m := &screenMapper{config: c}
+	m.target.Store(rect{})
+	if r, ok := parseGeometry(c.Name); ok {
+		m.fixed = true
+		m.setTarget(r)
+		return m
+	}
+	m.update()
+	return m
+}
+
+// run re-reads the monitor layout until ctx is done.
+func (m *screenMapper) run(ctx context.Context) {
+	if m.fixed {
+		return
+	}
+	t := time.NewTicker(screenPollInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			m.update()
+		}
+	}
+}
+
+func (m *screenMapper) update() {
+	desktop, outputs, err := probeScreens()
+	if err != nil {
+		if m.target.Load().(rect).empty() {
+			log.Printf("screen: %v, assuming a %gx%g desktop", err, tvWidth, tvHeight)
+			m.setTarget(rect{W: int(tvWidth), H: int(tvHeight)})
+		}
+		return
+	}
+	if m.config.Name == "" {
+		m.setTarget(desktop)
+		return
+	}
+	if o, ok := findOutput(outputs, m.config.Name); ok {
+		m.setTarget(o.bounds)
+		return
+	}
+	if m.target.Load().(rect).empty() {
+		log.Printf("screen: no monitor %q, using the whole desktop", m.config.Name)
+		m.setTarget(desktop)
+	}
+}
+
+func (m *screenMapper) setTarget(r rect) {
+	if m.config.Letterbox {
+		r = r.letterbox()
+	}
+	if old := m.target.Swap(r).(rect); old != r {
+		log.Printf("screen: pointer mapped to %v", r)
+	}
+}
+
+// findOutput looks up a monitor by name or index.
+func findOutput(outputs []screenOutput, name string) (screenOutput, bool) {
+	for _, o := range outputs {
+		if o.name == name {
+			return o, true
+		}
+	}
+	if i, err := strconv.Atoi(name); err == nil && i >= 0 && i < len(outputs) {
+		return outputs[i], true
+	}
+	return screenOutput{}, false
+}
+
+// toDesktop converts TV coordinates (tvWidth×tvHeight) to desktop pixels.
+func (m *screenMapper) toDesktop(x, y int) (int, int) {
+	t := m.target.Load().(rect)
+	fx := float64(t.X) + float64(x)*float64(t.W)/tvWidth
+	fy := float64(t.Y) + float64(y)*float64(t.H)/tvHeight
+	return int(math.Round(fx)) + m.config.OffsetX, int(math.Round(fy)) + m.config.OffsetY
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
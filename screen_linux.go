@@ -0,0 +1,90 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// xrandrMonitorRe matches a monitor line of `xrandr --listactivemonitors`:
+// " 0: +*HDMI-1 1920/1600x1080/900+2560+0  HDMI-1".
+var xrandrMonitorRe = regexp.MustCompile(`^\s*\d+:\s+\S+\s+(\d+)/\d+x(\d+)/\d+([+-]\d+)([+-]\d+)\s+(\S+)$`)
+
+// probeScreens returns the desktop and its monitors from xrandr, or just the
+// desktop size from xdotool if xrandr isn't available.
+func probeScreens() (desktop rect, outputs []screenOutput, err error) {
+	disp, xauth := getXDisplay()
+	if disp == "" {
+		disp = ":0"
+	}
+	cmd := exec.Command("/usr/bin/xrandr", "--listactivemonitors")
+	cmd.Env = append(os.Environ(), "DISPLAY="+disp, "XAUTHORITY="+xauth)
+	out, err := cmd.Output()
+	if err != nil {
+		w, h, gerr := getDisplaySize(disp, xauth)
+		if gerr != nil {
+			return rect{}, nil, fmt.Errorf("xrandr: %v, %v", err, gerr)
+		}
+		return rect{W: w, H: h}, nil, nil
+	}
+	return parseMonitors(string(out))
+}
+
+// parseMonitors reads the monitors of xrandr --listactivemonitors output.
+func parseMonitors(out string) (desktop rect, outputs []screenOutput, err error) {
+	for _, line := range strings.Split(out, "\n") {
+		m := xrandrMonitorRe.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		var o screenOutput
+		o.bounds.W, _ = strconv.Atoi(m[1])
+		o.bounds.H, _ = strconv.Atoi(m[2])
+		o.bounds.X, _ = strconv.Atoi(m[3])
+		o.bounds.Y, _ = strconv.Atoi(m[4])
+		o.name = m[5]
+		outputs = append(outputs, o)
+		desktop = desktop.union(o.bounds)
+	}
+	if len(outputs) == 0 {
+		return rect{}, nil, fmt.Errorf("xrandr: no monitors in %q", out)
+	}
+	return desktop, outputs, nil
+}
+
+// getDisplaySize queries actual screen dimensions via xdotool getdisplaygeometry.
+func getDisplaySize(disp, xauth string) (w, h int, err error) {
+	cmd := exec.Command("/usr/bin/xdotool", "getdisplaygeometry")
+	cmd.Env = append(os.Environ(), "DISPLAY="+disp, "XAUTHORITY="+xauth)
+	out, err := cmd.Output()
+	if err != nil {
+		return 0, 0, fmt.Errorf("getdisplaygeometry: %v", err)
+	}
+	parts := strings.Fields(strings.TrimSpace(string(out)))
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("getdisplaygeometry unexpected output: %q", out)
+	}
+	w, _ = strconv.Atoi(parts[0])
+	h, _ = strconv.Atoi(parts[1])
+	if w == 0 || h == 0 {
+		return 0, 0, fmt.Errorf("getdisplaygeometry unexpected output: %q", out)
+	}
+	return w, h, nil
+}
+
+// desktopSize returns the size of the desktop, or the TV's if it can't be
+// determined.
+func desktopSize() (w, h int) {
+	desktop, _, err := probeScreens()
+	if err != nil {
+		log.Printf("screen: %v, assuming a %gx%g desktop", err, tvWidth, tvHeight)
+		return int(tvWidth), int(tvHeight)
+	}
+	return desktop.X + desktop.W, desktop.Y + desktop.H
+}
@@ -0,0 +1,32 @@
+//go:build linux
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseMonitors(t *testing.T) {
+	desktop, outputs, err := parseMonitors(`Monitors: 2
+ 0: +*DP-1 2560/597x1440/336+0+0  DP-1
+ 1: +HDMI-1 1920/1600x1080/900+2560+360  HDMI-1
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (rect{0, 0, 4480, 1440}); desktop != want {
+		t.Errorf("desktop = %v, want %v", desktop, want)
+	}
+	want := []screenOutput{
+		{"DP-1", rect{0, 0, 2560, 1440}},
+		{"HDMI-1", rect{2560, 360, 1920, 1080}},
+	}
+	if !reflect.DeepEqual(outputs, want) {
+		t.Errorf("outputs = %v, want %v", outputs, want)
+	}
+
+	if _, _, err := parseMonitors("Monitors: 0\n"); err == nil {
+		t.Error("parseMonitors without monitors succeeded")
+	}
+}
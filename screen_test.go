@@ -0,0 +1,88 @@
+package main
+
+import "testing"
+
+func TestParseGeometry(t *testing.T) {
+	for _, tt := range []struct {
+		s    string
+		want rect
+		ok   bool
+	}{
+		{"1920x1080+0+0", rect{0, 0, 1920, 1080}, true},
+		{"2560x1440+1920-360", rect{1920, -360, 2560, 1440}, true},
+		{"800x600-100+50", rect{-100, 50, 800, 600}, true},
+		{"0x1080+0+0", rect{}, false},
+		{"1920x1080", rect{}, false},
+		{"HDMI-1", rect{}, false},
+		{"", rect{}, false},
+	} {
+		got, ok := parseGeometry(tt.s)
+		if ok != tt.ok || ok && got != tt.want {
+			t.Errorf("parseGeometry(%q) = %v, %v, want %v, %v", tt.s, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestLetterbox(t *testing.T) {
+	for _, tt := range []struct {
+		r, want rect
+	}{
+		// 16:9 is used as is.
+		{rect{0, 0, 1920, 1080}, rect{0, 0, 1920, 1080}},
+		// Wider screens get bars on the sides.
+		{rect{0, 0, 3440, 1440}, rect{440, 0, 2560, 1440}},
+		{rect{1920, 0, 5120, 1440}, rect{3200, 0, 2560, 1440}},
+		// Narrower ones at the top and bottom.
+		{rect{0, 0, 1024, 768}, rect{0, 96, 1024, 576}},
+		{rect{0, 0, 1920, 1200}, rect{0, 60, 1920, 1080}},
+		{rect{100, -200, 1080, 1920}, rect{100, 456, 1080, 608}},
+	} {
+		if got := tt.r.letterbox(); got != tt.want {
+			t.Errorf("%v.letterbox() = %v, want %v", tt.r, got, tt.want)
+		}
+	}
+}
+
+func TestFindOutput(t *testing.T) {
+	outputs := []screenOutput{
+		{"DP-1", rect{0, 0, 2560, 1440}},
+		{"HDMI-1", rect{2560, 0, 1920, 1080}},
+	}
+	for _, tt := range []struct {
+		name string
+		want string
+	}{
+		{"HDMI-1", "HDMI-1"},
+		{"DP-1", "DP-1"},
+		{"0", "DP-1"},
+		{"1", "HDMI-1"},
+		{"2", ""},
+		{"-1", ""},
+		{"hdmi-1", ""},
+	} {
+		o, ok := findOutput(outputs, tt.name)
+		if ok != (tt.want != "") || o.name != tt.want {
+			t.Errorf("findOutput(%q) = %q, %v, want %q", tt.name, o.name, ok, tt.want)
+		}
+	}
+}
+
+func TestScreenMapperToDesktop(t *testing.T) {
+	for _, tt := range []struct {
+		config       OutputConfig
+		x, y         int
+		wantX, wantY int
+	}{
+		{OutputConfig{Name: "1920x1080+0+0"}, 960, 540, 960, 540},
+		{OutputConfig{Name: "3840x2160+1920+0"}, 960, 540, 3840, 1080},
+		{OutputConfig{Name: "3840x2160+1920+0"}, 1919, 1079, 5758, 2158},
+		{OutputConfig{Name: "1920x1080+0+0", OffsetX: 10, OffsetY: -5}, 0, 0, 10, -5},
+		{OutputConfig{Name: "3440x1440+0+0", Letterbox: true}, 0, 0, 440, 0},
+		{OutputConfig{Name: "3440x1440+0+0", Letterbox: true}, 1920, 1080, 3000, 1440},
+	} {
+		m := newScreenMapper(tt.config)
+		if x, y := m.toDesktop(tt.x, tt.y); x != tt.wantX || y != tt.wantY {
+			t.Errorf("%+v: toDesktop(%d, %d) = %d, %d, want %d, %d", tt.config, tt.x, tt.y, x, y, tt.wantX, tt.wantY)
+		}
+	}
+}
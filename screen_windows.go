@@ -0,0 +1,29 @@
+//go:build windows
+
+package main
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/go-vgo/robotgo"
+)
+
+// probeScreens returns the virtual desktop and its monitors, named by index.
+func probeScreens() (desktop rect, outputs []screenOutput, err error) {
+	n := robotgo.DisplaysNum()
+	for i := 0; i < n; i++ {
+		var o screenOutput
+		o.name = strconv.Itoa(i)
+		o.bounds.X, o.bounds.Y, o.bounds.W, o.bounds.H = robotgo.GetDisplayBounds(i)
+		if o.bounds.empty() {
+			continue
+		}
+		outputs = append(outputs, o)
+		desktop = desktop.union(o.bounds)
+	}
+	if len(outputs) == 0 {
+		return rect{}, nil, errors.New("no displays found")
+	}
+	return desktop, outputs, nil
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// ScrollConfig controls how the remote's wheel scrolls. Unset fields inherit
+// from the base mapping.
+type ScrollConfig struct {
+	// NotchDelta is the wheel delta the TV reports for one notch of the
+	// remote's wheel, by default the smallest delta seen so far.
+	NotchDelta int `json:"notchDelta,omitempty"`
+	// LinesPerNotch is how many wheel steps the host scrolls for one notch
+	// of the remote, 1 by default. Fractions add up over several notches.
+	LinesPerNotch *float64 `json:"linesPerNotch,omitempty"`
+	// Natural scrolls the content with the wheel, like a touchpad.
+	Natural *bool `json:"natural,omitempty"`
+	// HiRes scrolls smoothly, in fractions of a notch, on backends that can.
+	// It is on by default.
+	HiRes *bool `json:"hiRes,omitempty"`
+}
+
+func (c ScrollConfig) merge(o ScrollConfig) ScrollConfig {
+	if o.NotchDelta != 0 {
+		c.NotchDelta = o.NotchDelta
+	}
+	if o.LinesPerNotch != nil {
+		c.LinesPerNotch = o.LinesPerNotch
+	}
+	if o.Natural != nil {
+		c.Natural = o.Natural
+	}
+	if o.HiRes != nil {
+		c.HiRes = o.HiRes
+	}
+	return c
+}
+
+func (c ScrollConfig) validate() error {
+	if c.NotchDelta < 0 {
+		return fmt.Errorf("scroll notchDelta must not be negative")
+	}
+	if c.LinesPerNotch != nil && *c.LinesPerNotch <= 0 {
+		return fmt.Errorf("scroll linesPerNotch must be positive")
+	}
+	return nil
+}
+
+func (c ScrollConfig) linesPerNotch() float64 {
+	if c.LinesPerNotch == nil {
+		return 1
+	}
+	return *c.LinesPerNotch
+}
+
+func (c ScrollConfig) natural() bool {
+	return c.Natural != nil && *c.Natural
+}
+
+func (c ScrollConfig) hiRes() bool {
+	return c.HiRes == nil || *c.HiRes
+}
+
+// heldBuiltins are handler builtins that act for as long as their key is
+// held.
+var heldBuiltins = map[string]func(h *handler, pressed bool){
+	// scroll-horizontal turns the wheel into a horizontal one.
+	"scroll-horizontal": func(h *handler, pressed bool) {
+		h.scrollHorizontal = pressed
+	},
+}
+
+// wheel scrolls by a wheel delta from the TV. The delta is summed up until
+// it makes a step of the backend, so no motion is lost.
+func (h *handler) wheel(delta int) {
+	c := h.mapping.pointer(h.profiles.profile()).Scroll
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.locked || delta == 0 {
+		return
+	}
+
+	notch := c.NotchDelta
+	if notch == 0 {
+		if h.wheelNotch == 0 || abs(delta) < h.wheelNotch {
+			h.wheelNotch = abs(delta)
+		}
+		notch = h.wheelNotch
+	}
+	v := float64(delta) / float64(notch) * c.linesPerNotch()
+	if c.natural() {
+		v = -v
+	}
+	hs, hiRes := h.sink.(hiResScroller)
+	hiRes = hiRes && c.hiRes()
+	if hiRes {
+		v *= hiResNotch
+	}
+
+	acc := &h.scrollY
+	if h.scrollHorizontal {
+		acc = &h.scrollX
+	}
+	if (*acc > 0) != (v > 0) {
+		// Turning the wheel back starts over.
+		*acc = 0
+	}
+	*acc += v
+	n := math.Trunc(*acc)
+	if n == 0 {
+		return
+	}
+	*acc -= n
+
+	// Up scrolls left, like shift and the wheel.
+	dx, dy := 0, int(n)
+	if h.scrollHorizontal {
+		dx, dy = -dy, 0
+	}
+	if hiRes {
+		hs.ScrollHiRes(dx, dy)
+	} else {
+		h.sink.Scroll(dx, dy)
+	}
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os/exec"
+	"strconv"
+	"time"
+	"unicode"
+
+	"github.com/netham45/magic4pc_altclient/m4p"
+)
+
+// defaultMultiTap is the longest pause between taps of a number key that
+// still cycle through its letters.
+const defaultMultiTap = time.Second
+
+// multiTapLetters are the characters of the number keys in text entry mode,
+// as on a phone keypad. Upper case is toggled with text-shift.
+var multiTapLetters = map[int]string{
+	m4p.Key0: " 0",
+	m4p.Key1: ".,?!'-1",
+	m4p.Key2: "abc2",
+	m4p.Key3: "def3",
+	m4p.Key4: "ghi4",
+	m4p.Key5: "jkl5",
+	m4p.Key6: "mno6",
+	m4p.Key7: "pqrs7",
+	m4p.Key8: "tuv8",
+	m4p.Key9: "wxyz9",
+}
+
+// TextEntryConfig sets up text entry mode, toggled by the text-entry
+// builtin.
+type TextEntryConfig struct {
+	// MultiTap is the longest pause between taps of a number key that still
+	// cycle through its letters.
+	MultiTap duration `json:"multiTap,omitempty"`
+	// Keys by keycode or name override the mapping while text entry is on,
+	// e.g. the arrows and OK to drive an on-screen keyboard.
+	Keys map[string]Action `json:"keys,omitempty"`
+	// OSK is an on-screen keyboard command, argv style, started when text
+	// entry starts and stopped when it ends.
+	OSK []string `json:"osk,omitempty"`
+
+	actions map[int]Action
+}
+
+func (c *TextEntryConfig) resolve() error {
+	if c.MultiTap < 0 {
+		return fmt.Errorf("textEntry multiTap must not be negative")
+	}
+	actions, err := resolveKeys(c.Keys)
+	if err != nil {
+		return fmt.Errorf("textEntry: %w", err)
+	}
+	c.actions = actions
+	return nil
+}
+
+// merge applies the settings of o on top of c.
+func (c *TextEntryConfig) merge(o *TextEntryConfig) {
+	if o.MultiTap != 0 {
+		c.MultiTap = o.MultiTap
+	}
+	if c.actions == nil {
+		c.actions = make(map[int]Action, len(o.actions))
+	}
+	for code, a := range o.actions {
+		c.actions[code] = a
+	}
+	if len(o.OSK) > 0 {
+		c.OSK = o.OSK
+	}
+}
+
+func (c *TextEntryConfig) multiTap() time.Duration {
+	return durationOr(c.MultiTap, defaultMultiTap)
+}
+
+// textEntry is the state of text entry mode.
+type textEntry struct {
+	active bool
+	upper  bool
+	// lastKey is the number key tapped last, at lastTap, and index the
+	// letter it typed.
+	lastKey int
+	lastTap time.Time
+	index   int
+	osk     *exec.Cmd
+}
+
+// text entry builtins.
+func init() {
+	// text-entry turns the number keys into a phone keypad until it runs
+	// again.
+	handlerBuiltins["text-entry"] = func(h *handler) {
+		h.setTextEntry(!h.text.active)
+	}
+	// text-shift switches between lower and upper case letters.
+	handlerBuiltins["text-shift"] = func(h *handler) {
+		h.text.upper = !h.text.upper
+		h.text.lastKey = 0
+	}
+}
+
+// setTextEntry turns text entry on or off, with h.mu held.
+func (h *handler) setTextEntry(on bool) {
+	t := &h.text
+	if on == t.active {
+		return
+	}
+	t.active = on
+	t.upper = false
+	t.lastKey = 0
+	if on {
+		log.Printf("input: text entry on")
+	} else {
+		log.Printf("input: text entry off")
+	}
+
+	osk := h.mapping.TextEntry.OSK
+	switch {
+	case on && len(osk) > 0:
+		cmd := exec.Command(osk[0], osk[1:]...)
+		if err := cmd.Start(); err != nil {
+			log.Printf("text entry: osk %v: %v", osk, err)
+			return
+		}
+		t.osk = cmd
+		go cmd.Wait()
+	case !on && t.osk != nil:
+		t.osk.Process.Kill()
+		t.osk = nil
+	}
+}
+
+// multiTap types the letter of a number key in text entry mode, with h.mu
+// held. Tapping the same key again in time replaces it with the next one.
+func (h *handler) multiTap(code int) {
+	t := &h.text
+	letters := []rune(multiTapLetters[code])
+	now := time.Now()
+	if code == t.lastKey && now.Sub(t.lastTap) < h.mapping.TextEntry.multiTap() {
+		t.index = (t.index + 1) % len(letters)
+		h.sink.Key("BackSpace", true)
+		h.sink.Key("BackSpace", false)
+	} else {
+		t.index = 0
+	}
+	t.lastKey = code
+	t.lastTap = now
+
+	r := letters[t.index]
+	if t.upper {
+		r = unicode.ToUpper(r)
+	}
+	h.sink.Type(string(r))
+}
+
+// action returns the action for a remote key, text entry keys first.
+func (h *handler) action(code int) (Action, bool) {
+	if h.text.active {
+		if a, ok := h.mapping.TextEntry.actions[code]; ok {
+			return a, true
+		}
+	}
+	return h.mapping.action(h.profiles.profile(), code)
+}
+
+// typeKeys types text with the keys of a US layout, for backends that
+// only have keys when the active layout can't be read. Other characters
+// are composed with Ctrl+Shift+U.
+func typeKeys(s InputSink, text string) {
+	compose := composeCheck()
+	for _, r := range text {
+		key, shift := keyForRune(r)
+		switch {
+		case key == "" && unicode.IsControl(r):
+			log.Printf("input: can't type %q", r)
+			continue
+		case key == "":
+			composeRune(s, r, compose)
+			continue
+		}
+		if shift {
+			s.Key("shift", true)
+		}
+		s.Key(key, true)
+		s.Key(key, false)
+		if shift {
+			s.Key("shift", false)
+		}
+	}
+}
+
+// composeRune types r as Ctrl+Shift+U, its hex code and space, the Unicode
+// input of IBus. It only does so while compose reports IBus running,
+// elsewhere the keys would type a stray u and the hex code.
+func composeRune(s InputSink, r rune, compose func() bool) {
+	if !compose() {
+		log.Printf("input: can't type %q without IBus", r)
+		return
+	}
+	s.Key("ctrl", true)
+	s.Key("shift", true)
+	s.Key("u", true)
+	s.Key("u", false)
+	s.Key("shift", false)
+	s.Key("ctrl", false)
+	for _, c := range strconv.FormatInt(int64(r), 16) {
+		s.Key(string(c), true)
+		s.Key(string(c), false)
+	}
+	s.Key("space", true)
+	s.Key("space", false)
+}
+
+// canCompose reports whether IBus is running to compose characters typed as
+// Ctrl+Shift+U and their hex code. It walks the processes of the host,
+// tests replace it.
+var canCompose = func() bool {
+	return probeHost(false).running("ibus-daemon")
+}
+
+// composeCheck returns canCompose for typing one text, the host is probed
+// once a character needs composing and only once.
+func composeCheck() func() bool {
+	var checked, ok bool
+	return func() bool {
+		if !checked {
+			checked, ok = true, canCompose()
+		}
+		return ok
+	}
+}
+
+// runeKeys are the keysyms of characters that don't name themselves.
+var runeKeys = map[rune]string{
+	' ':  "space",
+	'\n': "Return",
+	'\t': "Tab",
+}
+
+// shiftedRunes are the characters typed with shift on a US layout and the
+// key that types them.
+var shiftedRunes = map[rune]string{
+	'!': "1", '@': "2", '#': "3", '$': "4", '%': "5",
+	'^': "6", '&': "7", '*': "8", '(': "9", ')': "0",
+	'_': "-", '+': "=", '{': "[", '}': "]", '|': "\\",
+	':': ";", '"': "'", '<': ",", '>': ".", '?': "/", '~': "`",
+}
+
+// keyForRune returns the key that types r on a US layout and whether it
+// needs shift, or "" for characters outside of ASCII.
+func keyForRune(r rune) (key string, shift bool) {
+	if k, ok := runeKeys[r]; ok {
+		return k, false
+	}
+	if k, ok := shiftedRunes[r]; ok {
+		return k, true
+	}
+	if r > ' ' && r < unicode.MaxASCII {
+		return string(unicode.ToLower(r)), unicode.IsUpper(r)
+	}
+	return "", false
+}